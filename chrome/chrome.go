@@ -0,0 +1,244 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package chrome writes traces in the Trace Event Format, to be opened in `chrome://tracing` or
+// Perfetto (https://ui.perfetto.dev).
+package chrome
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tikv/minitrace-go"
+)
+
+// Event is a trace event. Only the fields used by minitrace are defined.
+type Event struct {
+	Name      string                 `json:"name"`
+	Category  string                 `json:"cat,omitempty"`
+	Phase     string                 `json:"ph"`
+	Timestamp json.Number            `json:"ts"`
+	Duration  json.Number            `json:"dur,omitempty"`
+	Scope     string                 `json:"s,omitempty"`
+	PID       int                    `json:"pid"`
+	TID       int                    `json:"tid"`
+	Args      map[string]interface{} `json:"args,omitempty"`
+}
+
+const (
+	PhaseComplete = "X"
+	PhaseInstant  = "i"
+	PhaseMetadata = "M"
+)
+
+// Exporter writes every trace into a file named after the trace ID in `Dir`.
+type Exporter struct {
+	Dir string
+}
+
+func NewExporter(dir string) *Exporter {
+	return &Exporter{Dir: dir}
+}
+
+func (e *Exporter) Export(ctx context.Context, traces []minitrace.Trace) error {
+	for _, trace := range traces {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := e.write(trace); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Exporter) write(trace minitrace.Trace) error {
+	f, err := os.Create(filepath.Join(e.Dir, trace.TraceID.String()+".json"))
+	if err != nil {
+		return err
+	}
+	if err := JSONEncode(f, MiniSpansToChromeEvents([]minitrace.Trace{trace})); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// JSONEncode writes the events as a JSON object, the form of the format accepted by all viewers.
+func JSONEncode(w io.Writer, events []Event) error {
+	return json.NewEncoder(w).Encode(struct {
+		TraceEvents     []Event `json:"traceEvents"`
+		DisplayTimeUnit string  `json:"displayTimeUnit"`
+	}{events, "ns"})
+}
+
+// MiniSpansToChromeEvents converts spans to complete events and their events to instant events.
+// Every trace is a process. Spans are laid out on threads so that spans of a thread nest: a span
+// is on the thread of its parent unless it overlaps a sibling there, e.g. when spawned
+// concurrently, in which case it moves to an idle thread.
+func MiniSpansToChromeEvents(traces []minitrace.Trace) []Event {
+	var events []Event
+	for i, trace := range traces {
+		pid := i + 1
+		events = append(events, Event{
+			Name:      "process_name",
+			Phase:     PhaseMetadata,
+			Timestamp: "0",
+			PID:       pid,
+			Args:      map[string]interface{}{"name": "trace " + trace.TraceID.String()},
+		})
+
+		lanes := assignLanes(trace.Spans)
+		for j := range trace.Spans {
+			span := &trace.Spans[j]
+			args := make(map[string]interface{}, len(span.Properties)+1)
+			for _, property := range span.Properties {
+				args[property.Key] = propertyValue(property)
+			}
+			if span.StatusCode == minitrace.StatusError {
+				args["error"] = span.StatusMessage
+			}
+
+			events = append(events, Event{
+				Name:      span.Event,
+				Category:  "minitrace",
+				Phase:     PhaseComplete,
+				Timestamp: microseconds(span.BeginUnixTimeNs),
+				Duration:  microseconds(span.DurationNs),
+				PID:       pid,
+				TID:       lanes[j],
+				Args:      args,
+			})
+
+			for _, event := range span.Events {
+				args := make(map[string]interface{}, len(event.Properties))
+				for _, property := range event.Properties {
+					args[property.Key] = propertyValue(property)
+				}
+				events = append(events, Event{
+					Name:      event.Name,
+					Category:  "minitrace",
+					Phase:     PhaseInstant,
+					Timestamp: microseconds(event.UnixTimeNs),
+					Scope:     "t",
+					PID:       pid,
+					TID:       lanes[j],
+					Args:      args,
+				})
+			}
+		}
+	}
+	return events
+}
+
+// Returns the thread of every span. Spans are placed in begin order, each on the thread of its
+// parent if it nests in the spans open there, otherwise on the first idle thread, so that spans
+// never appear nested in spans other than their ancestors.
+func assignLanes(spans []minitrace.Span) []int {
+	order := make([]int, len(spans))
+	for i := range order {
+		order[i] = i
+	}
+	// Parents begin before their children, or at the same time but last longer.
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := &spans[order[i]], &spans[order[j]]
+		if a.BeginUnixTimeNs != b.BeginUnixTimeNs {
+			return a.BeginUnixTimeNs < b.BeginUnixTimeNs
+		}
+		return a.DurationNs > b.DurationNs
+	})
+
+	laneOf := make(map[uint64]int, len(spans))
+	lanes := make([]int, len(spans))
+	// Spans open on each thread, innermost last.
+	type openSpan struct {
+		id  uint64
+		end uint64
+	}
+	var open [][]openSpan
+
+	// Closes the spans ended by `begin` and returns the spans still open.
+	openAt := func(lane int, begin uint64) []openSpan {
+		stack := open[lane]
+		for len(stack) > 0 && stack[len(stack)-1].end <= begin {
+			stack = stack[:len(stack)-1]
+		}
+		open[lane] = stack
+		return stack
+	}
+
+	for _, i := range order {
+		span := &spans[i]
+		begin, end := span.BeginUnixTimeNs, span.BeginUnixTimeNs+span.DurationNs
+
+		lane := -1
+		if parentLane, ok := laneOf[span.ParentID]; ok {
+			// The span must nest right in its parent, not in a sibling.
+			stack := openAt(parentLane, begin)
+			if len(stack) == 0 || (stack[len(stack)-1].id == span.ParentID && stack[len(stack)-1].end >= end) {
+				lane = parentLane
+			}
+		}
+		if lane < 0 {
+			for l := range open {
+				if len(openAt(l, begin)) == 0 {
+					lane = l
+					break
+				}
+			}
+		}
+		if lane < 0 {
+			lane = len(open)
+			open = append(open, nil)
+		}
+
+		open[lane] = append(open[lane], openSpan{id: span.ID, end: end})
+		laneOf[span.ID] = lane
+		lanes[i] = lane + 1
+	}
+	return lanes
+}
+
+func propertyValue(property minitrace.Property) interface{} {
+	switch property.Type {
+	case minitrace.PropertyInt:
+		return property.Int()
+	case minitrace.PropertyBool:
+		return property.Bool()
+	case minitrace.PropertyFloat:
+		// JSON has no NaN or infinities, which would fail the encoding of the whole file.
+		if f := property.Float(); !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return f
+		}
+		return property.ValueString()
+	default:
+		return property.ValueString()
+	}
+}
+
+// Formats nanoseconds as exact decimal microseconds, as float64 cannot hold unix times in
+// nanoseconds.
+func microseconds(ns uint64) json.Number {
+	s := strconv.FormatUint(ns/1000, 10)
+	if frac := ns % 1000; frac != 0 {
+		s += "." + strings.TrimRight(strconv.FormatUint(frac+1000, 10)[1:], "0")
+	}
+	return json.Number(s)
+}
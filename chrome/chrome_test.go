@@ -0,0 +1,128 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chrome
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tikv/minitrace-go"
+)
+
+func TestMiniSpansToChromeEvents(t *testing.T) {
+	const base = 1_600_000_000_000_000_000
+	trace := minitrace.Trace{TraceID: minitrace.TraceID{Low: 1}, Spans: []minitrace.Span{
+		{ID: 1, Event: "root", BeginUnixTimeNs: base, DurationNs: 100_000},
+		// Sequential children stay on the thread of the root.
+		{ID: 2, ParentID: 1, Event: "first", BeginUnixTimeNs: base + 1_500, DurationNs: 10_000,
+			Properties: []minitrace.Property{minitrace.IntProperty("rows", 3), minitrace.StringProperty("table", "t")}},
+		{ID: 3, ParentID: 2, Event: "nested", BeginUnixTimeNs: base + 2_000, DurationNs: 1_000,
+			Events: []minitrace.Event{{Name: "retry", UnixTimeNs: base + 2_500}}},
+		{ID: 4, ParentID: 1, Event: "second", BeginUnixTimeNs: base + 20_000, DurationNs: 30_000},
+		// Concurrent children overlapping "second" move to other threads.
+		{ID: 5, ParentID: 1, Event: "concurrent", BeginUnixTimeNs: base + 25_000, DurationNs: 30_000,
+			StatusCode: minitrace.StatusError, StatusMessage: "timeout"},
+		{ID: 6, ParentID: 1, Event: "short", BeginUnixTimeNs: base + 26_000, DurationNs: 1_000},
+		// A child of "second" stays on its thread, even though "concurrent" began later.
+		{ID: 7, ParentID: 4, Event: "late", BeginUnixTimeNs: base + 30_000, DurationNs: 1_000},
+		// The first idle thread is reused.
+		{ID: 8, ParentID: 1, Event: "reused", BeginUnixTimeNs: base + 40_000, DurationNs: 1_000},
+	}}
+
+	events := MiniSpansToChromeEvents([]minitrace.Trace{trace})
+	if len(events) != 1+len(trace.Spans)+1 {
+		t.Fatalf("unexpected number of events %d", len(events))
+	}
+	if events[0].Phase != PhaseMetadata || events[0].Args["name"] != "trace "+trace.TraceID.String() {
+		t.Fatalf("unexpected metadata event %v", events[0])
+	}
+
+	tids := map[uint64]int{}
+	spanEvents := map[string]Event{}
+	spanIndex := 0
+	for _, event := range events[1:] {
+		if event.Phase != PhaseComplete {
+			continue
+		}
+		tids[trace.Spans[spanIndex].ID] = event.TID
+		spanEvents[event.Name] = event
+		spanIndex++
+	}
+	expectedTIDs := map[uint64]int{1: 1, 2: 1, 3: 1, 4: 1, 5: 2, 6: 3, 7: 1, 8: 3}
+	for id, tid := range expectedTIDs {
+		if tids[id] != tid {
+			t.Fatalf("expected span %d on thread %d, got %v", id, tid, tids)
+		}
+	}
+
+	first := spanEvents["first"]
+	if first.Timestamp != "1600000000000001.5" || first.Duration != "10" {
+		t.Fatalf("unexpected timing %s %s", first.Timestamp, first.Duration)
+	}
+	if first.Args["rows"] != int64(3) || first.Args["table"] != "t" {
+		t.Fatalf("unexpected args %v", first.Args)
+	}
+	if spanEvents["concurrent"].Args["error"] != "timeout" {
+		t.Fatalf("unexpected error arg %v", spanEvents["concurrent"].Args)
+	}
+
+	var instant *Event
+	for i := range events {
+		if events[i].Phase == PhaseInstant {
+			instant = &events[i]
+		}
+	}
+	if instant == nil || instant.Name != "retry" || instant.TID != 1 || instant.Timestamp != "1600000000000002.5" {
+		t.Fatalf("unexpected instant event %v", instant)
+	}
+}
+
+func TestExporter(t *testing.T) {
+	ctx, root := minitrace.StartRootSpan(context.Background(), "root", minitrace.TraceID{Low: 42}, 0, nil)
+	child := minitrace.StartSpan(ctx, "child")
+	child.AddPropertyFloat("ratio", math.NaN())
+	child.Finish()
+	trace, _ := root.Collect()
+
+	dir, err := ioutil.TempDir("", "chrome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := NewExporter(dir).Export(context.Background(), []minitrace.Trace{trace}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, trace.TraceID.String()+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var file struct {
+		TraceEvents []map[string]interface{} `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+	if len(file.TraceEvents) != 3 || file.TraceEvents[1]["ph"] != "X" || file.TraceEvents[1]["name"] != "child" {
+		t.Fatalf("unexpected file %s", data)
+	}
+	if args := file.TraceEvents[1]["args"].(map[string]interface{}); args["ratio"] != "NaN" {
+		t.Fatalf("expected a non-finite float to be written as a string, got %v", args)
+	}
+}
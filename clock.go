@@ -0,0 +1,38 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package minitrace
+
+// Clock is the time source of a trace, see `WithClock`. Spans are timed by the monotonic clock,
+// which is converted to unix time once against the wall clock when the trace starts.
+type Clock interface {
+	// MonotonicNs returns nanoseconds since an arbitrary point, never decreasing.
+	MonotonicNs() uint64
+	// UnixNs returns nanoseconds since the unix epoch.
+	UnixNs() uint64
+}
+
+type systemClock struct{}
+
+// SystemClock returns the clock of the runtime, which traces use by default.
+func SystemClock() Clock {
+	return systemClock{}
+}
+
+func (systemClock) MonotonicNs() uint64 {
+	return monotimeNs()
+}
+
+func (systemClock) UnixNs() uint64 {
+	return unixtimeNs()
+}
@@ -15,6 +15,7 @@ package minitrace
 
 import (
 	"context"
+	"sort"
 	"sync"
 	"time"
 )
@@ -26,6 +27,8 @@ type spanContext struct {
 	// Shared trace context
 	traceContext *traceContext
 	spanID       uint64
+	// Guarded by the mutex of `traceContext`, so late events are not kept for a pushed span.
+	finished bool
 }
 
 func newSpanContext(ctx context.Context, tracingCtx *traceContext) *spanContext {
@@ -61,25 +64,51 @@ func (s *spanContext) Value(key interface{}) interface{} {
 
 type traceContext struct {
 	/// Frozen fields
-	traceID          uint64
+	traceID          TraceID
 	createUnixTimeNs uint64
 	createMonoTimeNs uint64
+	sampled          bool
+	clock            Clock // Nil for the runtime clock, which is called directly as it is faster
+	profileLabels    bool
+	runtimeTrace     bool
+	traceIDString    string // Set with `profileLabels` to avoid formatting it for every span
 
 	/// Shared mutable fields
 	mu             sync.Mutex
 	collectedSpans []Span
 	attachment     interface{}
 	collected      bool
+	// Events added by `AddEvent`, keyed by span ID, until the span finishes.
+	pendingEvents map[uint64][]Event
 }
 
-func newTraceContext(traceID uint64, attachment interface{}) *traceContext {
-	return &traceContext{
-		traceID:          traceID,
-		createUnixTimeNs: unixtimeNs(),
-		createMonoTimeNs: monotimeNs(),
-		attachment:       attachment,
-		collected:        false,
+func newTraceContext(traceID TraceID, attachment interface{}, sampled bool, clock Clock) *traceContext {
+	tc := &traceContext{
+		traceID:    traceID,
+		sampled:    sampled,
+		clock:      clock,
+		attachment: attachment,
+		collected:  false,
 	}
+	if clock != nil {
+		tc.createUnixTimeNs = clock.UnixNs()
+	} else {
+		tc.createUnixTimeNs = unixtimeNs()
+	}
+	tc.createMonoTimeNs = tc.monotimeNs()
+	return tc
+}
+
+func (tc *traceContext) monotimeNs() uint64 {
+	if tc.clock != nil {
+		return tc.clock.MonotonicNs()
+	}
+	return monotimeNs()
+}
+
+// Converts a monotonic time of the trace to unix time.
+func (tc *traceContext) unixTimeNs(monoTimeNs uint64) uint64 {
+	return (monoTimeNs - tc.createMonoTimeNs) + tc.createUnixTimeNs
 }
 
 func (tc *traceContext) accessAttachment(fn func(attachment interface{})) (ok bool) {
@@ -94,18 +123,51 @@ func (tc *traceContext) accessAttachment(fn func(attachment interface{})) (ok bo
 	return true
 }
 
-func (tc *traceContext) pushSpan(span *Span) (ok bool) {
+func (tc *traceContext) pushSpan(spanCtx *spanContext, span *Span) (ok bool) {
 	tc.mu.Lock()
 	defer tc.mu.Unlock()
 
+	spanCtx.finished = true
 	if tc.collected {
 		return false
 	}
 
+	if events, ok := tc.pendingEvents[span.ID]; ok {
+		delete(tc.pendingEvents, span.ID)
+		span.Events = append(span.Events, events...)
+		sort.SliceStable(span.Events, func(i, j int) bool {
+			return span.Events[i].UnixTimeNs < span.Events[j].UnixTimeNs
+		})
+	}
+
 	tc.collectedSpans = append(tc.collectedSpans, *span)
 	return true
 }
 
+// Finishes the span without recording it, dropping the events added through its context.
+func (tc *traceContext) discardSpan(spanCtx *spanContext) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	spanCtx.finished = true
+	delete(tc.pendingEvents, spanCtx.spanID)
+}
+
+func (tc *traceContext) pushEvent(spanCtx *spanContext, event Event) (ok bool) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if tc.collected || spanCtx.finished {
+		return false
+	}
+
+	if tc.pendingEvents == nil {
+		tc.pendingEvents = make(map[uint64][]Event)
+	}
+	tc.pendingEvents[spanCtx.spanID] = append(tc.pendingEvents[spanCtx.spanID], event)
+	return true
+}
+
 func (tc *traceContext) collect() (trace Trace, attachment interface{}) {
 	tc.mu.Lock()
 	defer tc.mu.Unlock()
@@ -121,6 +183,7 @@ func (tc *traceContext) collect() (trace Trace, attachment interface{}) {
 
 	tc.collectedSpans = nil
 	tc.attachment = nil
+	tc.pendingEvents = nil
 
 	return
 }
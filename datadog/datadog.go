@@ -14,15 +14,31 @@
 package datadog
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 
 	"github.com/tikv/minitrace-go"
 	"github.com/tinylib/msgp/msgp"
 )
 
+const (
+	// TraceIDHighKey is the meta tag holding the upper 64 bits of a 128-bit trace ID. As a trace-level
+	// tag, it is set on the local root span of the trace only.
+	TraceIDHighKey = "_dd.p.tid"
+	// EventsKey is the meta tag holding span events encoded in JSON.
+	EventsKey = "events"
+)
+
 func Send(buf io.Reader, agent string) error {
+	return send(context.Background(), buf, agent)
+}
+
+func send(ctx context.Context, buf io.Reader, agent string) error {
 	req, err := http.NewRequest("POST", fmt.Sprintf("http://%s/v0.4/traces", agent), buf)
 	if err != nil {
 		return fmt.Errorf("cannot create http request: %v", err)
@@ -30,7 +46,7 @@ func Send(buf io.Reader, agent string) error {
 	req.Header.Set("Datadog-Meta-Tracer-Version", "v1.27.0")
 	req.Header.Set("Content-Type", "application/msgpack")
 
-	response, err := http.DefaultClient.Do(req)
+	response, err := http.DefaultClient.Do(req.WithContext(ctx))
 	if err != nil {
 		return err
 	}
@@ -60,6 +76,34 @@ func MessagePackEncode(buf io.Writer, spanList SpanList) error {
 	return nil
 }
 
+// Exporter sends traces to a Datadog agent, one HTTP request per batch.
+type Exporter struct {
+	ServiceName string
+	Agent       string
+}
+
+func NewExporter(serviceName string, agent string) *Exporter {
+	return &Exporter{ServiceName: serviceName, Agent: agent}
+}
+
+func (e *Exporter) Export(ctx context.Context, traces []minitrace.Trace) error {
+	buf := bytes.NewBuffer([]byte{})
+	w := msgp.NewWriter(buf)
+	if err := w.WriteArrayHeader(uint32(len(traces))); err != nil {
+		return err
+	}
+	for _, trace := range traces {
+		if err := MiniSpansToDatadogSpanList(e.ServiceName, trace).EncodeMsg(w); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return send(ctx, buf, e.Agent)
+}
+
 func MiniSpansToDatadogSpanList(
 	serviceName string,
 	trace minitrace.Trace,
@@ -67,23 +111,121 @@ func MiniSpansToDatadogSpanList(
 	spans := trace.Spans
 	ddSpans := make([]*Span, 0, len(spans))
 
-	for _, span := range spans {
+	// Datadog carries the lower 64 bits in `trace_id` and the upper 64 bits as a hex-encoded tag.
+	var traceIDHigh string
+	rootIndex := -1
+	if trace.TraceID.High != 0 {
+		traceIDHigh = fmt.Sprintf("%016x", trace.TraceID.High)
+		rootIndex = localRootIndex(spans)
+	}
+
+	for i, span := range spans {
 		meta := make(map[string]string)
+		var metrics map[string]float64
 		for _, property := range span.Properties {
-			meta[property.Key] = property.Value
+			// Numeric properties go to metrics, so they can be aggregated.
+			switch property.Type {
+			case minitrace.PropertyInt, minitrace.PropertyDuration:
+				if metrics == nil {
+					metrics = make(map[string]float64)
+				}
+				metrics[property.Key] = float64(property.Int())
+			case minitrace.PropertyFloat:
+				if metrics == nil {
+					metrics = make(map[string]float64)
+				}
+				metrics[property.Key] = property.Float()
+			default:
+				meta[property.Key] = property.ValueString()
+			}
 		}
+		if i == rootIndex {
+			meta[TraceIDHighKey] = traceIDHigh
+		}
+
+		if len(span.Events) > 0 {
+			meta[EventsKey] = encodeEvents(span.Events)
+		}
+
+		var spanError int32
+		if span.StatusCode == minitrace.StatusError {
+			spanError = 1
+			meta["error.msg"] = span.StatusMessage
+			if span.ErrorType != "" {
+				meta["error.type"] = span.ErrorType
+			}
+		}
+
 		ddSpan := &Span{
 			Name:     span.Event,
 			Service:  serviceName,
 			Start:    int64(span.BeginUnixTimeNs),
 			Duration: int64(span.DurationNs),
 			Meta:     meta,
+			Metrics:  metrics,
 			SpanID:   span.ID,
-			TraceID:  trace.TraceID,
+			TraceID:  trace.TraceID.Low,
 			ParentID: span.ParentID,
+			Error:    spanError,
 		}
 		ddSpans = append(ddSpans, ddSpan)
 	}
 
 	return ddSpans
 }
+
+// Returns the index of the first span whose parent is not in the trace, which is the root span or,
+// for a trace joining a remote one, the span with the remote parent.
+func localRootIndex(spans []minitrace.Span) int {
+	ids := make(map[uint64]struct{}, len(spans))
+	for _, span := range spans {
+		ids[span.ID] = struct{}{}
+	}
+	for i, span := range spans {
+		if _, ok := ids[span.ParentID]; !ok {
+			return i
+		}
+	}
+	return 0
+}
+
+type spanEvent struct {
+	Name         string                 `json:"name"`
+	TimeUnixNano uint64                 `json:"time_unix_nano"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+}
+
+func encodeEvents(events []minitrace.Event) string {
+	ddEvents := make([]spanEvent, 0, len(events))
+	for _, event := range events {
+		var attributes map[string]interface{}
+		if len(event.Properties) > 0 {
+			attributes = make(map[string]interface{}, len(event.Properties))
+			for _, property := range event.Properties {
+				switch property.Type {
+				case minitrace.PropertyInt, minitrace.PropertyDuration:
+					attributes[property.Key] = property.Int()
+				case minitrace.PropertyBool:
+					attributes[property.Key] = property.Bool()
+				case minitrace.PropertyFloat:
+					// JSON has no NaN or infinities, which would fail the encoding of all events.
+					if f := property.Float(); !math.IsNaN(f) && !math.IsInf(f, 0) {
+						attributes[property.Key] = f
+					} else {
+						attributes[property.Key] = property.ValueString()
+					}
+				default:
+					attributes[property.Key] = property.Value
+				}
+			}
+		}
+		ddEvents = append(ddEvents, spanEvent{
+			Name:         event.Name,
+			TimeUnixNano: event.UnixTimeNs,
+			Attributes:   attributes,
+		})
+	}
+
+	b, _ := json.Marshal(ddEvents)
+	return string(b)
+}
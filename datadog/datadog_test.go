@@ -16,17 +16,24 @@ package datadog
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"math"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/tikv/minitrace-go"
+	"github.com/tinylib/msgp/msgp"
 )
 
 func TestDatadog(t *testing.T) {
-	ctx, handle := minitrace.StartRootSpan(context.Background(), "root", 10010, 0,nil)
+	ctx, handle := minitrace.StartRootSpan(context.Background(), "root", minitrace.TraceID{High: 10086, Low: 10010}, 0, nil)
 	handle.AddProperty("event1", "root")
 	handle.AddProperty("event2", "root")
 	var wg sync.WaitGroup
@@ -64,9 +71,85 @@ func TestDatadog(t *testing.T) {
 
 	buf := bytes.NewBuffer([]byte{})
 	spanList := MiniSpansToDatadogSpanList("datadog-test", trace)
+	for _, span := range spanList {
+		// The upper bits are a trace-level tag, carried by the root span only.
+		expectedHigh := ""
+		if span.ParentID == 0 {
+			expectedHigh = "0000000000002766"
+		}
+		if span.TraceID != 10010 || span.Meta[TraceIDHighKey] != expectedHigh {
+			t.Fatalf("unmatched trace ID of span %q: got %s:%d", span.Name, span.Meta[TraceIDHighKey], span.TraceID)
+		}
+	}
 	if err := MessagePackEncode(buf, spanList); err == nil {
 		_ = Send(buf, "127.0.0.1:8126")
 	} else {
 		t.Fatal(err)
 	}
 }
+
+func TestExporter(t *testing.T) {
+	var received []SpanList
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reader := msgp.NewReader(r.Body)
+		n, err := reader.ReadArrayHeader()
+		if err != nil {
+			t.Error(err)
+		}
+		for i := uint32(0); i < n; i++ {
+			var spanList SpanList
+			if err := spanList.DecodeMsg(reader); err != nil {
+				t.Error(err)
+			}
+			received = append(received, spanList)
+		}
+	}))
+	defer server.Close()
+
+	var traces []minitrace.Trace
+	for i := uint64(1); i <= 3; i++ {
+		ctx, handle := minitrace.StartRootSpan(context.Background(), "root", minitrace.TraceID{Low: i}, 0, nil)
+		child := minitrace.StartSpan(ctx, "child")
+		child.AddEvent("retry", minitrace.IntProperty("attempt", 2), minitrace.FloatProperty("backoff", math.Inf(1)))
+		child.AddPropertyInt("rows", 42)
+		child.AddPropertyBool("cached", true)
+		child.SetError(io.EOF)
+		child.Finish()
+		trace, _ := handle.Collect()
+		traces = append(traces, trace)
+	}
+
+	exporter := NewExporter("datadog-test", strings.TrimPrefix(server.URL, "http://"))
+	if err := exporter.Export(context.Background(), traces); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 3 {
+		t.Fatalf("expected %d traces, got %d", 3, len(received))
+	}
+	for i, spanList := range received {
+		if len(spanList) != 2 || spanList[0].TraceID != uint64(i+1) {
+			t.Fatalf("unexpected trace %d: %+v", i, spanList)
+		}
+		for _, span := range spanList {
+			if span.Name != "child" {
+				continue
+			}
+			if span.Error != 1 || span.Meta["error.msg"] != "EOF" || span.Meta["error.type"] != "*errors.errorString" {
+				t.Fatalf("unexpected error fields: %d %v", span.Error, span.Meta)
+			}
+			if span.Metrics["rows"] != 42 || span.Meta["cached"] != "true" {
+				t.Fatalf("unexpected typed properties: %v %v", span.Metrics, span.Meta)
+			}
+			var events []map[string]interface{}
+			if err := json.Unmarshal([]byte(span.Meta[EventsKey]), &events); err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != 1 || events[0]["name"] != "retry" {
+				t.Fatalf("unexpected events %v", events)
+			}
+			if attributes := events[0]["attributes"].(map[string]interface{}); attributes["attempt"] != 2.0 || attributes["backoff"] != "+Inf" {
+				t.Fatalf("unexpected events %v", events)
+			}
+		}
+	}
+}
@@ -78,6 +78,36 @@ func (z *Span) DecodeMsg(dc *msgp.Reader) (err error) {
 				}
 				z.Meta[za0001] = za0002
 			}
+		case "metrics":
+			var zb0003 uint32
+			zb0003, err = dc.ReadMapHeader()
+			if err != nil {
+				err = msgp.WrapError(err, "Metrics")
+				return
+			}
+			if z.Metrics == nil {
+				z.Metrics = make(map[string]float64, zb0003)
+			} else if len(z.Metrics) > 0 {
+				for key := range z.Metrics {
+					delete(z.Metrics, key)
+				}
+			}
+			for zb0003 > 0 {
+				zb0003--
+				var za0003 string
+				var za0004 float64
+				za0003, err = dc.ReadString()
+				if err != nil {
+					err = msgp.WrapError(err, "Metrics")
+					return
+				}
+				za0004, err = dc.ReadFloat64()
+				if err != nil {
+					err = msgp.WrapError(err, "Metrics", za0003)
+					return
+				}
+				z.Metrics[za0003] = za0004
+			}
 		case "span_id":
 			z.SpanID, err = dc.ReadUint64()
 			if err != nil {
@@ -96,6 +126,12 @@ func (z *Span) DecodeMsg(dc *msgp.Reader) (err error) {
 				err = msgp.WrapError(err, "ParentID")
 				return
 			}
+		case "error":
+			z.Error, err = dc.ReadInt32()
+			if err != nil {
+				err = msgp.WrapError(err, "Error")
+				return
+			}
 		default:
 			err = dc.Skip()
 			if err != nil {
@@ -110,12 +146,16 @@ func (z *Span) DecodeMsg(dc *msgp.Reader) (err error) {
 // EncodeMsg implements msgp.Encodable
 func (z *Span) EncodeMsg(en *msgp.Writer) (err error) {
 	// omitempty: check for empty values
-	zb0001Len := uint32(8)
-	var zb0001Mask uint8 /* 8 bits */
+	zb0001Len := uint32(10)
+	var zb0001Mask uint16 /* 10 bits */
 	if z.Meta == nil {
 		zb0001Len--
 		zb0001Mask |= 0x10
 	}
+	if z.Metrics == nil {
+		zb0001Len--
+		zb0001Mask |= 0x20
+	}
 	// variable map header, size zb0001Len
 	err = en.Append(0x80 | uint8(zb0001Len))
 	if err != nil {
@@ -188,6 +228,30 @@ func (z *Span) EncodeMsg(en *msgp.Writer) (err error) {
 			}
 		}
 	}
+	if (zb0001Mask & 0x20) == 0 { // if not empty
+		// write "metrics"
+		err = en.Append(0xa7, 0x6d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x73)
+		if err != nil {
+			return
+		}
+		err = en.WriteMapHeader(uint32(len(z.Metrics)))
+		if err != nil {
+			err = msgp.WrapError(err, "Metrics")
+			return
+		}
+		for za0003, za0004 := range z.Metrics {
+			err = en.WriteString(za0003)
+			if err != nil {
+				err = msgp.WrapError(err, "Metrics")
+				return
+			}
+			err = en.WriteFloat64(za0004)
+			if err != nil {
+				err = msgp.WrapError(err, "Metrics", za0003)
+				return
+			}
+		}
+	}
 	// write "span_id"
 	err = en.Append(0xa7, 0x73, 0x70, 0x61, 0x6e, 0x5f, 0x69, 0x64)
 	if err != nil {
@@ -218,6 +282,16 @@ func (z *Span) EncodeMsg(en *msgp.Writer) (err error) {
 		err = msgp.WrapError(err, "ParentID")
 		return
 	}
+	// write "error"
+	err = en.Append(0xa5, 0x65, 0x72, 0x72, 0x6f, 0x72)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt32(z.Error)
+	if err != nil {
+		err = msgp.WrapError(err, "Error")
+		return
+	}
 	return
 }
 
@@ -230,7 +304,14 @@ func (z *Span) Msgsize() (s int) {
 			s += msgp.StringPrefixSize + len(za0001) + msgp.StringPrefixSize + len(za0002)
 		}
 	}
-	s += 8 + msgp.Uint64Size + 9 + msgp.Uint64Size + 10 + msgp.Uint64Size
+	s += 8 + msgp.MapHeaderSize
+	if z.Metrics != nil {
+		for za0003, za0004 := range z.Metrics {
+			_ = za0004
+			s += msgp.StringPrefixSize + len(za0003) + msgp.Float64Size
+		}
+	}
+	s += 8 + msgp.Uint64Size + 9 + msgp.Uint64Size + 10 + msgp.Uint64Size + 6 + msgp.Int32Size
 	return
 }
 
@@ -0,0 +1,17 @@
+module github.com/tikv/minitrace-go/grpc
+
+go 1.25.0
+
+require (
+	github.com/tikv/minitrace-go v0.0.0-20261017135809-0305372f147c
+	google.golang.org/grpc v1.82.1
+)
+
+require (
+	go.opentelemetry.io/otel v1.44.0 // indirect
+	golang.org/x/net v0.57.0 // indirect
+	golang.org/x/sys v0.47.0 // indirect
+	golang.org/x/text v0.40.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20260720211330-0afa2a65878a // indirect
+	google.golang.org/protobuf v1.36.11 // indirect
+)
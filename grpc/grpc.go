@@ -0,0 +1,233 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package grpc traces gRPC clients and servers with minitrace. Span contexts are propagated as W3C
+// Trace Context entries of the gRPC metadata.
+package grpc
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync/atomic"
+
+	"github.com/tikv/minitrace-go"
+	"github.com/tikv/minitrace-go/propagation"
+	"github.com/tikv/minitrace-go/reporter"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Options configures the server interceptors. Zero fields take their defaults.
+type Options struct {
+	// Receives the traces started by the server. Defaults to `reporter.Report`.
+	Report func(trace minitrace.Trace)
+	// Options of the traces started by the server, e.g. `minitrace.WithClock`.
+	RootOptions []minitrace.RootOption
+}
+
+func (opts *Options) report() func(trace minitrace.Trace) {
+	if opts.Report != nil {
+		return opts.Report
+	}
+	return func(trace minitrace.Trace) {
+		reporter.Report(trace)
+	}
+}
+
+// Adapts `metadata.MD` to `propagation.TextMapCarrier`.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if v := metadata.MD(c).Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+// Names spans "package.Service/Method" after the full method name "/package.Service/Method".
+func spanName(fullMethod string) string {
+	return strings.TrimPrefix(fullMethod, "/")
+}
+
+func startClientSpan(ctx context.Context, method string) (context.Context, minitrace.SpanHandle) {
+	ctx, span := minitrace.StartSpanWithContext(ctx, spanName(method))
+	span.AddProperty("rpc.method", method)
+
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	propagation.Inject(ctx, metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md), span
+}
+
+func finishWithStatus(span *minitrace.SpanHandle, err error) {
+	s := status.Convert(err)
+	span.AddPropertyInt("rpc.grpc.status_code", int64(s.Code()))
+	if err != nil {
+		span.SetStatus(minitrace.StatusError, s.Message())
+	}
+	span.Finish()
+}
+
+// UnaryClientInterceptor traces calls by a child span of the span active in the call context.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, span := startClientSpan(ctx, method)
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		finishWithStatus(&span, err)
+		return err
+	}
+}
+
+// StreamClientInterceptor traces streams by a child span of the span active in the stream context.
+// The span finishes when `RecvMsg` reports the end of the stream or an error, including the
+// cancellation of the stream context, so a stream abandoned without reading it to the end is not
+// recorded. With `minitrace.WithProfileLabels` or `minitrace.WithRuntimeTrace`, `RecvMsg` must be
+// called on the goroutine which opened the stream, see `minitrace.SpanHandle.Finish`.
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, span := startClientSpan(ctx, method)
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			finishWithStatus(&span, err)
+			return nil, err
+		}
+		return &clientStream{ClientStream: stream, desc: desc, span: span}, nil
+	}
+}
+
+type clientStream struct {
+	grpc.ClientStream
+	desc *grpc.StreamDesc
+
+	// `SendMsg` may be called concurrently with `RecvMsg`, which finishes the span.
+	sent     atomic.Int64
+	received int64
+	span     minitrace.SpanHandle
+	finished bool
+}
+
+func (s *clientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.sent.Add(1)
+	}
+	return err
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case err == io.EOF:
+		s.finish(nil)
+	case err != nil:
+		s.finish(err)
+	default:
+		s.received++
+		// Without server streaming, the only response ends the stream.
+		if !s.desc.ServerStreams {
+			s.finish(nil)
+		}
+	}
+	return err
+}
+
+func (s *clientStream) finish(err error) {
+	if s.finished {
+		return
+	}
+	s.finished = true
+	s.span.AddPropertyInt("rpc.messages_sent", s.sent.Load())
+	s.span.AddPropertyInt("rpc.messages_received", s.received)
+	finishWithStatus(&s.span, err)
+}
+
+// Starts a root span for an incoming call, joining the remote trace if the metadata carries one.
+func startServerSpan(ctx context.Context, method string, opts []minitrace.RootOption) (context.Context, minitrace.TraceHandle) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		ctx = propagation.Extract(ctx, metadataCarrier(md))
+	}
+	ctx, root := minitrace.StartRootSpan(ctx, spanName(method), minitrace.TraceID{}, 0, nil, opts...)
+	root.AddProperty("rpc.method", method)
+	return ctx, root
+}
+
+func collect(root *minitrace.TraceHandle, err error, report func(trace minitrace.Trace)) {
+	finishWithStatus(&root.SpanHandle, err)
+	trace, _ := root.Collect()
+	if len(trace.Spans) > 0 {
+		report(trace)
+	}
+}
+
+// UnaryServerInterceptor traces every call by a root span, reported once the handler returns.
+func UnaryServerInterceptor(opts Options) grpc.UnaryServerInterceptor {
+	report := opts.report()
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, root := startServerSpan(ctx, info.FullMethod, opts.RootOptions)
+		resp, err := handler(ctx, req)
+		collect(&root, err, report)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor traces every stream by a root span, reported once the handler returns.
+func StreamServerInterceptor(opts Options) grpc.StreamServerInterceptor {
+	report := opts.report()
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, root := startServerSpan(ss.Context(), info.FullMethod, opts.RootOptions)
+		s := &serverStream{ServerStream: ss, ctx: ctx}
+		err := handler(srv, s)
+		root.AddPropertyInt("rpc.messages_sent", s.sent.Load())
+		root.AddPropertyInt("rpc.messages_received", s.received.Load())
+		collect(&root, err, report)
+		return err
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+
+	sent     atomic.Int64
+	received atomic.Int64
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *serverStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sent.Add(1)
+	}
+	return err
+}
+
+func (s *serverStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.received.Add(1)
+	}
+	return err
+}
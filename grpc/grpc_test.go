@@ -0,0 +1,241 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpc
+
+import (
+	"context"
+	"io"
+	"net"
+	rtrace "runtime/trace"
+	"sync"
+	"testing"
+
+	"github.com/tikv/minitrace-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type testServer struct {
+	testpb.UnimplementedTestServiceServer
+}
+
+func (testServer) EmptyCall(ctx context.Context, req *testpb.Empty) (*testpb.Empty, error) {
+	return nil, status.Error(codes.Unavailable, "region unavailable")
+}
+
+func (testServer) UnaryCall(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+	if _, _, ok := minitrace.CurrentID(ctx); !ok {
+		return nil, status.Error(codes.Internal, "no span in the handler context")
+	}
+	return &testpb.SimpleResponse{}, nil
+}
+
+func (testServer) StreamingOutputCall(req *testpb.StreamingOutputCallRequest, stream grpc.ServerStreamingServer[testpb.StreamingOutputCallResponse]) error {
+	for range req.GetResponseParameters() {
+		if err := stream.Send(&testpb.StreamingOutputCallResponse{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (testServer) StreamingInputCall(stream grpc.ClientStreamingServer[testpb.StreamingInputCallRequest, testpb.StreamingInputCallResponse]) error {
+	for {
+		if _, err := stream.Recv(); err == io.EOF {
+			return stream.SendAndClose(&testpb.StreamingInputCallResponse{})
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func propertiesOf(span minitrace.Span) map[string]minitrace.Property {
+	properties := map[string]minitrace.Property{}
+	for _, p := range span.Properties {
+		properties[p.Key] = p
+	}
+	return properties
+}
+
+func TestInterceptors(t *testing.T) {
+	var mu sync.Mutex
+	serverTraces := map[string]minitrace.Trace{}
+	opts := Options{Report: func(trace minitrace.Trace) {
+		mu.Lock()
+		defer mu.Unlock()
+		serverTraces[trace.Spans[0].Event] = trace
+	}}
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor(opts)),
+		grpc.StreamInterceptor(StreamServerInterceptor(opts)),
+	)
+	testpb.RegisterTestServiceServer(server, testServer{})
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer server.Stop()
+
+	conn, err := grpc.NewClient(
+		"passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(StreamClientInterceptor()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := testpb.NewTestServiceClient(conn)
+
+	ctx, root := minitrace.StartRootSpan(context.Background(), "client", minitrace.TraceID{High: 1, Low: 2}, 0, nil)
+	rootID, _, _ := minitrace.CurrentID(ctx)
+	if _, err := client.EmptyCall(ctx, &testpb.Empty{}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := client.UnaryCall(ctx, &testpb.SimpleRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	output, err := client.StreamingOutputCall(ctx, &testpb.StreamingOutputCallRequest{
+		ResponseParameters: make([]*testpb.ResponseParameters, 3),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, err := output.Recv(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	input, err := client.StreamingInputCall(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := input.Send(&testpb.StreamingInputCallRequest{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := input.CloseAndRecv(); err != nil {
+		t.Fatal(err)
+	}
+	clientTrace, _ := root.Collect()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(clientTrace.Spans) != 5 || len(serverTraces) != 4 {
+		t.Fatalf("expected 5 client spans and 4 server traces, got %v and %v", clientTrace, serverTraces)
+	}
+	clientSpans := map[string]minitrace.Span{}
+	for _, span := range clientTrace.Spans {
+		clientSpans[span.Event] = span
+	}
+
+	for method, messages := range map[string][2]int64{
+		"grpc.testing.TestService/EmptyCall":           {},
+		"grpc.testing.TestService/UnaryCall":           {},
+		"grpc.testing.TestService/StreamingOutputCall": {1, 3},
+		"grpc.testing.TestService/StreamingInputCall":  {2, 1},
+	} {
+		clientSpan, serverTrace := clientSpans[method], serverTraces[method]
+		if clientSpan.ParentID != rootID {
+			t.Fatalf("expected %s to be a child of the client root", method)
+		}
+		if serverTrace.TraceID != clientTrace.TraceID || serverTrace.Spans[0].ParentID != clientSpan.ID {
+			t.Fatalf("expected the server span of %s to join the client span", method)
+		}
+
+		p := propertiesOf(clientSpan)
+		if p["rpc.method"].Value != "/"+method {
+			t.Fatalf("unexpected method property %v", p["rpc.method"])
+		}
+		if messages != [2]int64{} {
+			if p["rpc.messages_sent"].Int() != messages[0] || p["rpc.messages_received"].Int() != messages[1] {
+				t.Fatalf("unexpected client message counts of %s: %v", method, clientSpan.Properties)
+			}
+			sp := propertiesOf(serverTrace.Spans[0])
+			if sp["rpc.messages_received"].Int() != messages[0] || sp["rpc.messages_sent"].Int() != messages[1] {
+				t.Fatalf("unexpected server message counts of %s: %v", method, serverTrace.Spans[0].Properties)
+			}
+		}
+	}
+
+	failed := clientSpans["grpc.testing.TestService/EmptyCall"]
+	if failed.StatusCode != minitrace.StatusError || failed.StatusMessage != "region unavailable" ||
+		propertiesOf(failed)["rpc.grpc.status_code"].Int() != int64(codes.Unavailable) {
+		t.Fatalf("unexpected client status %s %q", failed.StatusCode, failed.StatusMessage)
+	}
+	if s := serverTraces["grpc.testing.TestService/EmptyCall"].Spans[0]; s.StatusCode != minitrace.StatusError {
+		t.Fatalf("unexpected server status %s", s.StatusCode)
+	}
+}
+
+// Fails `RecvMsg` once the stream context is canceled, as a real stream does.
+type cancelableStream struct {
+	grpc.ClientStream
+	ctx context.Context
+}
+
+func (s cancelableStream) RecvMsg(m interface{}) error {
+	<-s.ctx.Done()
+	return status.FromContextError(s.ctx.Err()).Err()
+}
+
+func TestStreamClientCanceled(t *testing.T) {
+	// Regions must end on the goroutine which started them, so the span may only finish in
+	// `RecvMsg`, never on a goroutine watching the context.
+	if err := rtrace.Start(io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	defer rtrace.Stop()
+
+	ctx, root := minitrace.StartRootSpan(context.Background(), "client", minitrace.TraceID{Low: 1}, 0, nil, minitrace.WithRuntimeTrace())
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return cancelableStream{ctx: ctx}, nil
+	}
+	open := func(method string) (grpc.ClientStream, context.CancelFunc) {
+		ctx, cancel := context.WithCancel(ctx)
+		stream, err := StreamClientInterceptor()(ctx, &grpc.StreamDesc{ServerStreams: true}, nil, method, streamer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stream, cancel
+	}
+
+	canceled, cancel := open("/test/Canceled")
+	cancel()
+	if err := canceled.RecvMsg(nil); status.Code(err) != codes.Canceled {
+		t.Fatalf("expected the stream to be canceled, got %v", err)
+	}
+	_, cancel = open("/test/Abandoned")
+	cancel()
+
+	trace, _ := root.Collect()
+	if len(trace.Spans) != 2 {
+		t.Fatalf("expected only the canceled stream span to be finished, got %v", trace.Spans)
+	}
+	if s := trace.Spans[0]; s.Event != "test/Canceled" || s.StatusCode != minitrace.StatusError {
+		t.Fatalf("unexpected span %v", s)
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package http traces net/http servers and clients with minitrace.
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/tikv/minitrace-go"
+	"github.com/tikv/minitrace-go/propagation"
+	"github.com/tikv/minitrace-go/reporter"
+)
+
+// Options configures a traced handler. Zero fields take their defaults.
+type Options struct {
+	// Names the root span. Defaults to the pattern matched by `http.ServeMux` on Go 1.23+, or
+	// "HTTP <method>" if there is none.
+	SpanName func(r *http.Request) string
+	// Receives the collected traces. Defaults to `reporter.Report`.
+	Report func(trace minitrace.Trace)
+	// Options of the traces started by the handler, e.g. `minitrace.WithClock`.
+	RootOptions []minitrace.RootOption
+}
+
+type handler struct {
+	handler http.Handler
+	opts    Options
+}
+
+// NewHandler wraps `h` so every request is traced by a root span, joining the remote trace if the
+// request carries W3C Trace Context headers.
+func NewHandler(h http.Handler, opts Options) http.Handler {
+	if opts.Report == nil {
+		opts.Report = func(trace minitrace.Trace) {
+			reporter.Report(trace)
+		}
+	}
+	return &handler{handler: h, opts: opts}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := propagation.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, root := minitrace.StartRootSpan(ctx, "HTTP "+r.Method, minitrace.TraceID{}, 0, nil, h.opts.RootOptions...)
+	root.AddProperty("http.method", r.Method)
+	root.AddProperty("http.path", r.URL.Path)
+
+	rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+	r = r.WithContext(ctx)
+	defer func() {
+		// A panicking handler is recorded as failed, then the panic is passed on to `http.Server`.
+		p := recover()
+
+		// The route is known only after `http.ServeMux` has dispatched the request.
+		if h.opts.SpanName != nil {
+			root.SetEvent(h.opts.SpanName(r))
+		} else if pattern := requestPattern(r); pattern != "" {
+			root.SetEvent(pattern)
+		}
+		if p == nil || rw.wroteHeader {
+			root.AddPropertyInt("http.status_code", int64(rw.status))
+		}
+		root.AddPropertyInt("http.response_size", rw.size)
+		if p != nil {
+			root.SetStatus(minitrace.StatusError, fmt.Sprintf("panic: %v", p))
+		} else if rw.status >= 500 {
+			root.SetStatus(minitrace.StatusError, http.StatusText(rw.status))
+		}
+
+		trace, _ := root.Collect()
+		if len(trace.Spans) > 0 {
+			h.opts.Report(trace)
+		}
+		if p != nil {
+			panic(p)
+		}
+	}()
+
+	h.handler.ServeHTTP(wrapResponseWriter(rw), r)
+}
+
+// Records the status code and the number of bytes written.
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	size        int64
+	wroteHeader bool
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+// Unwrap lets `http.ResponseController` reach the underlying writer.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Exposes `http.Flusher`, `http.Hijacker` and `http.Pusher` only if the underlying writer implements
+// them, so handlers probing for them by type assertion see the same capabilities as without tracing.
+func wrapResponseWriter(w *responseWriter) http.ResponseWriter {
+	flusher, isFlusher := w.ResponseWriter.(http.Flusher)
+	hijacker, isHijacker := w.ResponseWriter.(http.Hijacker)
+	pusher, isPusher := w.ResponseWriter.(http.Pusher)
+	switch {
+	case isFlusher && isHijacker && isPusher:
+		return struct {
+			*responseWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{w, flusher, hijacker, pusher}
+	case isFlusher && isHijacker:
+		return struct {
+			*responseWriter
+			http.Flusher
+			http.Hijacker
+		}{w, flusher, hijacker}
+	case isFlusher && isPusher:
+		return struct {
+			*responseWriter
+			http.Flusher
+			http.Pusher
+		}{w, flusher, pusher}
+	case isHijacker && isPusher:
+		return struct {
+			*responseWriter
+			http.Hijacker
+			http.Pusher
+		}{w, hijacker, pusher}
+	case isFlusher:
+		return struct {
+			*responseWriter
+			http.Flusher
+		}{w, flusher}
+	case isHijacker:
+		return struct {
+			*responseWriter
+			http.Hijacker
+		}{w, hijacker}
+	case isPusher:
+		return struct {
+			*responseWriter
+			http.Pusher
+		}{w, pusher}
+	default:
+		return w
+	}
+}
+
+// Transport traces outgoing requests by a child span of the span active in the request context,
+// and propagates it by W3C Trace Context headers. The span finishes when the response headers are
+// received.
+type Transport struct {
+	Base http.RoundTripper
+}
+
+// NewTransport wraps `base`. A nil `base` means `http.DefaultTransport`.
+func NewTransport(base http.RoundTripper) *Transport {
+	return &Transport{Base: base}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	ctx, span := minitrace.StartSpanWithContext(req.Context(), "HTTP "+req.Method)
+	defer span.Finish()
+	span.AddProperty("http.method", req.Method)
+	span.AddProperty("http.url", redactURL(req.URL))
+
+	// A RoundTripper must not modify the request, so headers are injected into a copy.
+	req = req.Clone(ctx)
+	propagation.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	span.AddPropertyInt("http.status_code", int64(resp.StatusCode))
+	if resp.StatusCode >= 400 {
+		span.SetStatus(minitrace.StatusError, http.StatusText(resp.StatusCode))
+	}
+	return resp, nil
+}
+
+// Returns the URL with any password replaced by "xxxxx", as `url.URL.Redacted` does on Go 1.15+.
+func redactURL(u *url.URL) string {
+	if u.User == nil {
+		return u.String()
+	}
+	if _, ok := u.User.Password(); !ok {
+		return u.String()
+	}
+	redacted := *u
+	redacted.User = url.UserPassword(u.User.Username(), "xxxxx")
+	return redacted.String()
+}
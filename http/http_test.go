@@ -0,0 +1,206 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tikv/minitrace-go"
+	"github.com/tikv/minitrace-go/minitracetest"
+)
+
+func propertiesOf(span minitrace.Span) map[string]minitrace.Property {
+	properties := map[string]minitrace.Property{}
+	for _, p := range span.Properties {
+		properties[p.Key] = p
+	}
+	return properties
+}
+
+func TestHandlerAndTransport(t *testing.T) {
+	var mu sync.Mutex
+	var traces []minitrace.Trace
+	report := func(trace minitrace.Trace) {
+		mu.Lock()
+		defer mu.Unlock()
+		traces = append(traces, trace)
+	}
+
+	// The route is recorded on the request by `http.ServeMux` only since Go 1.23.
+	wantEvent := "HTTP GET"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {
+		if _, _, ok := minitrace.CurrentID(r.Context()); !ok {
+			t.Errorf("expected a span in the request context")
+		}
+		if pattern := requestPattern(r); pattern != "" {
+			wantEvent = pattern
+		}
+		_, _ = io.WriteString(w, "hello")
+	})
+	mux.HandleFunc("/fail", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	server := httptest.NewServer(NewHandler(mux, Options{Report: report}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewTransport(nil)}
+	ctx, root := minitrace.StartRootSpan(context.Background(), "client", minitrace.TraceID{High: 1, Low: 2}, 0, nil)
+	for _, path := range []string{"/users/42", "/fail"} {
+		req, err := http.NewRequestWithContext(ctx, "GET", server.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	clientTrace, _ := root.Collect()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(traces) != 2 || len(clientTrace.Spans) != 3 {
+		t.Fatalf("expected 2 server traces and 3 client spans, got %v and %v", traces, clientTrace)
+	}
+
+	server0 := traces[0].Spans[0]
+	if traces[0].TraceID != clientTrace.TraceID {
+		t.Fatalf("expected the server to join the client trace, got %s", traces[0].TraceID)
+	}
+	if server0.Event != wantEvent {
+		t.Fatalf("expected the span to be named from the route, got %q", server0.Event)
+	}
+	var clientSpan minitrace.Span
+	for _, span := range clientTrace.Spans {
+		if span.ID == server0.ParentID {
+			clientSpan = span
+		}
+	}
+	if clientSpan.Event != "HTTP GET" || propertiesOf(clientSpan)["http.status_code"].Int() != 200 {
+		t.Fatalf("expected the server span to be a child of the client span, got %v", clientSpan)
+	}
+	p := propertiesOf(server0)
+	if p["http.method"].Value != "GET" || p["http.path"].Value != "/users/42" ||
+		p["http.status_code"].Int() != 200 || p["http.response_size"].Int() != 5 {
+		t.Fatalf("unexpected server properties %v", server0.Properties)
+	}
+
+	server1 := traces[1].Spans[0]
+	if server1.StatusCode != minitrace.StatusError || propertiesOf(server1)["http.status_code"].Int() != 500 {
+		t.Fatalf("expected an error status, got %s %v", server1.StatusCode, server1.Properties)
+	}
+}
+
+func TestHandlerNewTrace(t *testing.T) {
+	var traces []minitrace.Trace
+	h := NewHandler(http.NotFoundHandler(), Options{
+		SpanName:    func(r *http.Request) string { return "custom" },
+		Report:      func(trace minitrace.Trace) { traces = append(traces, trace) },
+		RootOptions: []minitrace.RootOption{minitrace.WithClock(minitracetest.NewManualClock(time.Unix(1, 0)))},
+	})
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+
+	if len(traces) != 1 || traces[0].TraceID.IsZero() || traces[0].Spans[0].Event != "custom" {
+		t.Fatalf("expected a new trace with a custom span name, got %v", traces)
+	}
+	if traces[0].Spans[0].ParentID != 0 {
+		t.Fatalf("expected no parent without propagated context")
+	}
+	if span := traces[0].Spans[0]; span.BeginUnixTimeNs != uint64(time.Second) || span.DurationNs != 0 {
+		t.Fatalf("expected the span to be timed by the manual clock, got %+v", span)
+	}
+}
+
+func TestHandlerHijack(t *testing.T) {
+	server := httptest.NewServer(NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Pusher); ok {
+			t.Errorf("expected no http.Pusher over HTTP/1.1")
+		}
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			t.Errorf("expected the writer to forward http.Hijacker")
+			return
+		}
+		conn, buf, err := hijacker.Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		_, _ = buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		_ = buf.Flush()
+	}), Options{Report: func(minitrace.Trace) {}}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "hijacked" {
+		t.Fatalf("expected the hijacked response, got %q", body)
+	}
+
+	rw := wrapResponseWriter(&responseWriter{ResponseWriter: httptest.NewRecorder()})
+	if _, ok := rw.(http.Hijacker); ok {
+		t.Fatalf("expected no http.Hijacker when the underlying writer has none")
+	}
+	if _, ok := rw.(http.Flusher); !ok {
+		t.Fatalf("expected the writer to forward http.Flusher")
+	}
+	// Hides the methods of the recorder other than those of `http.ResponseWriter`.
+	rw = wrapResponseWriter(&responseWriter{ResponseWriter: struct{ http.ResponseWriter }{httptest.NewRecorder()}})
+	if _, ok := rw.(http.Flusher); ok {
+		t.Fatalf("expected no http.Flusher when the underlying writer has none")
+	}
+}
+
+func TestHandlerPanic(t *testing.T) {
+	recorder := minitracetest.NewRecorder()
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}), Options{Report: func(trace minitrace.Trace) { recorder.Report(trace) }})
+
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Fatalf("expected the panic to be passed on, got %v", p)
+			}
+		}()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}()
+
+	traces := recorder.Traces()
+	if len(traces) != 1 {
+		t.Fatalf("expected the trace to be reported, got %v", traces)
+	}
+	span := traces[0].Spans[0]
+	if span.StatusCode != minitrace.StatusError || span.StatusMessage != "panic: boom" {
+		t.Fatalf("expected an error status, got %s %q", span.StatusCode, span.StatusMessage)
+	}
+	if _, ok := propertiesOf(span)["http.status_code"]; ok {
+		t.Fatalf("expected no status code for a response never written, got %v", span.Properties)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package minitrace
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"sync/atomic"
+)
+
+// IDGenerator generates span IDs, and trace IDs for `StartRootSpan` called with a zero trace ID.
+// Generated IDs must not be zero, and generators must be safe for concurrent use.
+type IDGenerator interface {
+	NewSpanID() uint64
+	NewTraceID() TraceID
+}
+
+type idGeneratorHolder struct {
+	generator IDGenerator
+}
+
+var globalIDGenerator atomic.Value
+
+// SetIDGenerator replaces the generator of span and trace IDs. A nil generator restores the
+// default, `FastIDGenerator`.
+func SetIDGenerator(generator IDGenerator) {
+	globalIDGenerator.Store(idGeneratorHolder{generator})
+}
+
+func idGenerator() IDGenerator {
+	holder, ok := globalIDGenerator.Load().(idGeneratorHolder)
+	if !ok || holder.generator == nil {
+		return fastIDGenerator{}
+	}
+	return holder.generator
+}
+
+// Returns a new span ID.
+func nextID() uint64 {
+	return idGenerator().NewSpanID()
+}
+
+type fastIDGenerator struct{}
+
+// FastIDGenerator returns the default generator. On Go 1.22+ it draws from the per-thread generator
+// of the runtime, which is lock-free, and on earlier versions from a generator shared under a
+// mutex. Either is seeded by the operating system, so IDs do not collide across processes. It is
+// not suitable where IDs must be unpredictable, see `CryptoIDGenerator`.
+func FastIDGenerator() IDGenerator {
+	return fastIDGenerator{}
+}
+
+func (fastIDGenerator) NewSpanID() uint64 {
+	for {
+		if id := fastRandUint64(); id != 0 {
+			return id
+		}
+	}
+}
+
+func (g fastIDGenerator) NewTraceID() TraceID {
+	return TraceID{High: fastRandUint64(), Low: g.NewSpanID()}
+}
+
+type cryptoIDGenerator struct{}
+
+// CryptoIDGenerator returns a generator reading `crypto/rand`, for IDs which must be
+// unpredictable, e.g. trace IDs exposed to untrusted clients. It is several times slower than
+// `FastIDGenerator`.
+func CryptoIDGenerator() IDGenerator {
+	return cryptoIDGenerator{}
+}
+
+func (cryptoIDGenerator) NewSpanID() uint64 {
+	var buf [8]byte
+	for {
+		_, _ = crand.Read(buf[:])
+		if id := binary.LittleEndian.Uint64(buf[:]); id != 0 {
+			return id
+		}
+	}
+}
+
+func (cryptoIDGenerator) NewTraceID() TraceID {
+	var buf [16]byte
+	for {
+		_, _ = crand.Read(buf[:])
+		id := TraceID{High: binary.BigEndian.Uint64(buf[:8]), Low: binary.BigEndian.Uint64(buf[8:])}
+		if !id.IsZero() {
+			return id
+		}
+	}
+}
+
+// SequentialIDGenerator numbers span IDs and trace IDs from 1, each counter separately, for
+// reproducible output such as golden files in tests.
+type SequentialIDGenerator struct {
+	spanID  uint64
+	traceID uint64
+}
+
+func NewSequentialIDGenerator() *SequentialIDGenerator {
+	return &SequentialIDGenerator{}
+}
+
+func (g *SequentialIDGenerator) NewSpanID() uint64 {
+	return atomic.AddUint64(&g.spanID, 1)
+}
+
+func (g *SequentialIDGenerator) NewTraceID() TraceID {
+	return TraceID{Low: atomic.AddUint64(&g.traceID, 1)}
+}
@@ -14,7 +14,11 @@
 package jaeger
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
 	"io"
+	"math"
 	"net"
 
 	"github.com/tikv/minitrace-go"
@@ -31,6 +35,40 @@ func Send(buf []byte, agent string) error {
 	return err
 }
 
+// Exporter sends traces to a Jaeger agent over UDP, one `emitBatch` packet per trace.
+type Exporter struct {
+	ServiceName string
+	Agent       string
+}
+
+func NewExporter(serviceName string, agent string) *Exporter {
+	return &Exporter{ServiceName: serviceName, Agent: agent}
+}
+
+func (e *Exporter) Export(ctx context.Context, traces []minitrace.Trace) error {
+	conn, err := net.Dial("udp", e.Agent)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	buf := bytes.NewBuffer(make([]byte, 0, 4096))
+	for _, trace := range traces {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		buf.Reset()
+		if err := ThriftCompactEncode(buf, MiniSpansToJaegerTrace(e.ServiceName, trace)); err != nil {
+			return err
+		}
+		if _, err := conn.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func MiniSpansToJaegerTrace(
 	serviceName string,
 	trace minitrace.Trace,
@@ -39,18 +77,36 @@ func MiniSpansToJaegerTrace(
 	retSpans := make([]Span, 0, len(spans))
 
 	for _, span := range spans {
-		var tags []struct {
-			Key   string
-			Value string
-		}
+		var tags []Tag
+		var logs []Log
 
 		for _, property := range span.Properties {
-			tags = append(tags, struct {
-				Key   string
-				Value string
-			}{
-				Key:   property.Key,
-				Value: property.Value,
+			tags = append(tags, propertyToTag(property))
+		}
+
+		for _, event := range span.Events {
+			fields := make([]Tag, 0, len(event.Properties)+1)
+			fields = append(fields, Tag{Key: "event", Value: event.Name})
+			for _, property := range event.Properties {
+				fields = append(fields, propertyToTag(property))
+			}
+			logs = append(logs, Log{
+				UnixTimeUs: int64(event.UnixTimeNs / 1000),
+				Fields:     fields,
+			})
+		}
+
+		if span.StatusCode == minitrace.StatusError {
+			tags = append(tags, Tag{Key: "error", Type: TagBool, Bool: true})
+
+			// Jaeger shows error details as a log at the end of the span.
+			fields := []Tag{{Key: "event", Value: "error"}, {Key: "message", Value: span.StatusMessage}}
+			if span.ErrorType != "" {
+				fields = append(fields, Tag{Key: "error.kind", Value: span.ErrorType})
+			}
+			logs = append(logs, Log{
+				UnixTimeUs: int64((span.BeginUnixTimeNs + span.DurationNs) / 1000),
+				Fields:     fields,
 			})
 		}
 
@@ -60,17 +116,40 @@ func MiniSpansToJaegerTrace(
 			StartUnixTimeUs: int64(span.BeginUnixTimeNs / 1000),
 			DurationUs:      int64(span.DurationNs / 1000),
 			OperationName:   span.Event,
+			RefType:         refTypeToJaeger(span.RefType),
 			Tags:            tags,
+			Logs:            logs,
 		})
 	}
 
 	return Trace{
-		TraceIDLow: int64(trace.TraceID),
+		TraceIDLow:  int64(trace.TraceID.Low),
+		TraceIDHigh: int64(trace.TraceID.High),
 		ServiceName: serviceName,
 		Spans:       retSpans,
 	}
 }
 
+func refTypeToJaeger(refType minitrace.RefType) RefType {
+	if refType == minitrace.FollowsFrom {
+		return RefFollowsFrom
+	}
+	return RefChildOf
+}
+
+func propertyToTag(property minitrace.Property) Tag {
+	switch property.Type {
+	case minitrace.PropertyInt, minitrace.PropertyDuration:
+		return Tag{Key: property.Key, Type: TagLong, Long: property.Int()}
+	case minitrace.PropertyBool:
+		return Tag{Key: property.Key, Type: TagBool, Bool: property.Bool()}
+	case minitrace.PropertyFloat:
+		return Tag{Key: property.Key, Type: TagDouble, Float: property.Float()}
+	default:
+		return Tag{Key: property.Key, Value: property.Value}
+	}
+}
+
 func ThriftCompactEncode(
 	b io.Writer,
 	trace Trace,
@@ -85,13 +164,7 @@ func ThriftCompactEncode(
 
 	// len of spans
 	buf = append(buf, 0x19)
-	spanLen := len(trace.Spans)
-	if spanLen < 15 {
-		buf = append(buf, byte(spanLen<<4)|12)
-	} else {
-		buf = append(buf, 0b1111_0000|12)
-		encodeVarInt(&buf, uint64(spanLen))
-	}
+	encodeListHeader(&buf, len(trace.Spans))
 
 	for _, span := range trace.Spans {
 		buf = append(buf, 0x16)
@@ -105,16 +178,21 @@ func ThriftCompactEncode(
 		buf = append(buf, 0x18)
 		encodeBytes(&buf, []byte(span.OperationName))
 
-		buf = append(buf, []byte{0x19, 0x1c, 0x15}...)
-		encodeVarInt(&buf, uint64(zigzagFromI32(int32(1 /* Follow from */))))
-		buf = append(buf, 0x16)
-		encodeVarInt(&buf, zigzagFromI64(trace.TraceIDLow))
-		buf = append(buf, 0x16)
-		encodeVarInt(&buf, zigzagFromI64(trace.TraceIDHigh))
-		buf = append(buf, 0x16)
-		encodeVarInt(&buf, zigzagFromI64(span.ParentID))
-		buf = append(buf, 0x00)
-		buf = append(buf, 0x15)
+		// Root spans have no references, so the field delta of flags depends on it.
+		if span.ParentID != 0 {
+			buf = append(buf, []byte{0x19, 0x1c, 0x15}...)
+			encodeVarInt(&buf, uint64(zigzagFromI32(int32(span.RefType))))
+			buf = append(buf, 0x16)
+			encodeVarInt(&buf, zigzagFromI64(trace.TraceIDLow))
+			buf = append(buf, 0x16)
+			encodeVarInt(&buf, zigzagFromI64(trace.TraceIDHigh))
+			buf = append(buf, 0x16)
+			encodeVarInt(&buf, zigzagFromI64(span.ParentID))
+			buf = append(buf, 0x00)
+			buf = append(buf, 0x15)
+		} else {
+			buf = append(buf, 0x25)
+		}
 		buf = append(buf, 0x02)
 
 		buf = append(buf, 0x16)
@@ -124,23 +202,22 @@ func ThriftCompactEncode(
 		tagLen := len(span.Tags)
 		if tagLen > 0 {
 			buf = append(buf, 0x19)
-			if tagLen < 15 {
-				buf = append(buf, byte((tagLen<<4)|12))
+			encodeTags(&buf, span.Tags)
+		}
+		if len(span.Logs) > 0 {
+			// Field delta depends on whether the tags field is present.
+			if tagLen > 0 {
+				buf = append(buf, 0x19)
 			} else {
-				buf = append(buf, byte(0b1111_0000|12))
-				encodeVarInt(&buf, uint64(tagLen))
+				buf = append(buf, 0x29)
 			}
+			encodeListHeader(&buf, len(span.Logs))
 
-			for _, t := range span.Tags {
-				buf = append(buf, 0x18)
-				encodeBytes(&buf, []byte(t.Key))
-
-				buf = append(buf, 0x15)
-				buf = append(buf, 0x00)
-
-				buf = append(buf, 0x18)
-				encodeBytes(&buf, []byte(t.Value))
-
+			for _, l := range span.Logs {
+				buf = append(buf, 0x16)
+				encodeVarInt(&buf, zigzagFromI64(l.UnixTimeUs))
+				buf = append(buf, 0x19)
+				encodeTags(&buf, l.Fields)
 				buf = append(buf, 0x00)
 			}
 		}
@@ -154,6 +231,52 @@ func ThriftCompactEncode(
 	return err
 }
 
+// Encodes a list of `Tag` structs, excluding the field header.
+func encodeTags(buf *[]byte, tags []Tag) {
+	encodeListHeader(buf, len(tags))
+
+	for _, t := range tags {
+		*buf = append(*buf, 0x18)
+		encodeBytes(buf, []byte(t.Key))
+
+		*buf = append(*buf, 0x15)
+		encodeVarInt(buf, uint64(zigzagFromI32(int32(t.Type))))
+
+		// The value field follows `vType` (field 2) with a delta depending on the type.
+		switch t.Type {
+		case TagDouble:
+			*buf = append(*buf, 0x27)
+			var double [8]byte
+			binary.LittleEndian.PutUint64(double[:], math.Float64bits(t.Float))
+			*buf = append(*buf, double[:]...)
+		case TagBool:
+			if t.Bool {
+				*buf = append(*buf, 0x31)
+			} else {
+				*buf = append(*buf, 0x32)
+			}
+		case TagLong:
+			*buf = append(*buf, 0x46)
+			encodeVarInt(buf, zigzagFromI64(t.Long))
+		default:
+			*buf = append(*buf, 0x18)
+			encodeBytes(buf, []byte(t.Value))
+		}
+
+		*buf = append(*buf, 0x00)
+	}
+}
+
+// Encodes the header of a list of structs.
+func encodeListHeader(buf *[]byte, n int) {
+	if n < 15 {
+		*buf = append(*buf, byte((n<<4)|12))
+	} else {
+		*buf = append(*buf, byte(0b1111_0000|12))
+		encodeVarInt(buf, uint64(n))
+	}
+}
+
 func encodeBytes(buf *[]byte, bytes []byte) {
 	encodeVarInt(buf, uint64(len(bytes)))
 	*buf = append(*buf, bytes...)
@@ -16,7 +16,10 @@ package jaeger
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"fmt"
+	"io"
+	"math"
 	"math/rand"
 	"sync"
 	"testing"
@@ -26,7 +29,7 @@ import (
 )
 
 func TestJaeger(t *testing.T) {
-	ctx, handle := minitrace.StartRootSpan(context.Background(), "root", 10010, 0, nil)
+	ctx, handle := minitrace.StartRootSpan(context.Background(), "root", minitrace.TraceID{High: 10086, Low: 10010}, 0, nil)
 	handle.AddProperty("event1", "root")
 	handle.AddProperty("event2", "root")
 	var wg sync.WaitGroup
@@ -64,7 +67,268 @@ func TestJaeger(t *testing.T) {
 	rand.Seed(time.Now().UnixNano())
 
 	trace := MiniSpansToJaegerTrace("minitrace-test", mtrace)
+	if trace.TraceIDHigh != 10086 || trace.TraceIDLow != 10010 {
+		t.Fatalf("unmatched trace ID: got %d:%d", trace.TraceIDHigh, trace.TraceIDLow)
+	}
 	if err := ThriftCompactEncode(buf, trace); err == nil {
+		if spans := decodeEmitBatch(t, buf.Bytes()); len(spans) != 29 {
+			t.Fatalf("expected %d spans, got %d", 29, len(spans))
+		}
 		_ = Send(buf.Bytes(), "127.0.0.1:6831")
 	}
 }
+
+// A minimal Thrift compact protocol decoder. Structs are decoded into maps keyed by field ID, lists
+// into slices and binaries into strings.
+type thriftDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *thriftDecoder) byte() byte {
+	if len(d.buf) == 0 {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	b := d.buf[0]
+	d.buf = d.buf[1:]
+	return b
+}
+
+func (d *thriftDecoder) varint() uint64 {
+	var n uint64
+	for shift := uint(0); d.err == nil; shift += 7 {
+		b := d.byte()
+		n |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	return n
+}
+
+func (d *thriftDecoder) zigzag() int64 {
+	n := d.varint()
+	return int64(n>>1) ^ -int64(n&1)
+}
+
+func (d *thriftDecoder) value(typ byte) interface{} {
+	switch typ {
+	case 1:
+		return true
+	case 2:
+		return false
+	case 3:
+		return d.byte()
+	case 4, 5, 6:
+		return d.zigzag()
+	case 7:
+		if len(d.buf) < 8 {
+			d.err = io.ErrUnexpectedEOF
+			return nil
+		}
+		f := math.Float64frombits(binary.LittleEndian.Uint64(d.buf))
+		d.buf = d.buf[8:]
+		return f
+	case 8:
+		n := int(d.varint())
+		if len(d.buf) < n {
+			d.err = io.ErrUnexpectedEOF
+			return nil
+		}
+		s := string(d.buf[:n])
+		d.buf = d.buf[n:]
+		return s
+	case 9:
+		h := d.byte()
+		n, elemTyp := int(h>>4), h&0x0f
+		if n == 15 {
+			n = int(d.varint())
+		}
+		list := make([]interface{}, 0, n)
+		for i := 0; i < n && d.err == nil; i++ {
+			if elemTyp == 1 || elemTyp == 2 {
+				// Booleans in lists take a full byte.
+				list = append(list, d.byte() == 1)
+				continue
+			}
+			list = append(list, d.value(elemTyp))
+		}
+		return list
+	case 12:
+		s := map[int16]interface{}{}
+		var lastID int16
+		for d.err == nil {
+			h := d.byte()
+			if h == 0 {
+				break
+			}
+			if delta := int16(h >> 4); delta != 0 {
+				lastID += delta
+			} else {
+				lastID = int16(d.zigzag())
+			}
+			s[lastID] = d.value(h & 0x0f)
+		}
+		return s
+	default:
+		d.err = fmt.Errorf("unsupported type %d", typ)
+		return nil
+	}
+}
+
+// Decodes an `emitBatch` message and returns the spans in the batch.
+func decodeEmitBatch(t *testing.T, b []byte) []map[int16]interface{} {
+	d := &thriftDecoder{buf: b}
+	if d.byte() != 0x82 || d.byte() != 0x81 {
+		t.Fatalf("unexpected message header")
+	}
+	d.varint()
+	if name := d.value(8); name != "emitBatch" {
+		t.Fatalf("unexpected method %v", name)
+	}
+	args := d.value(12).(map[int16]interface{})
+	if d.err != nil || len(d.buf) != 0 {
+		t.Fatalf("malformed message: %v, %d bytes left", d.err, len(d.buf))
+	}
+
+	var spans []map[int16]interface{}
+	for _, span := range args[1].(map[int16]interface{})[2].([]interface{}) {
+		spans = append(spans, span.(map[int16]interface{}))
+	}
+	return spans
+}
+
+func TestThriftCompactEncodeLogs(t *testing.T) {
+	ctx, handle := minitrace.StartRootSpan(context.Background(), "root", minitrace.TraceID{Low: 10010}, 0, nil)
+	child := minitrace.StartSpan(ctx, "child")
+	child.AddEvent("retry", minitrace.IntProperty("attempt", 2))
+	child.SetError(io.EOF)
+	child.Finish()
+	handle.SetStatus(minitrace.StatusOK, "")
+	mtrace, _ := handle.Collect()
+
+	buf := bytes.NewBuffer(nil)
+	if err := ThriftCompactEncode(buf, MiniSpansToJaegerTrace("minitrace-test", mtrace)); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := decodeEmitBatch(t, buf.Bytes())
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	for _, span := range spans {
+		_, hasTags := span[10]
+		_, hasLogs := span[11]
+		if span[5] == "root" {
+			if hasTags || hasLogs {
+				t.Fatalf("expected no tags or logs on the root span")
+			}
+			continue
+		}
+
+		tag := span[10].([]interface{})[0].(map[int16]interface{})
+		if tag[1] != "error" || tag[2] != int64(TagBool) || tag[5] != true {
+			t.Fatalf("unexpected tag %v", tag)
+		}
+		logs := span[11].([]interface{})
+		if len(logs) != 2 {
+			t.Fatalf("expected 2 logs, got %d", len(logs))
+		}
+		// Allow 1us for truncating start time and duration separately.
+		start, end := span[8].(int64), span[8].(int64)+span[9].(int64)+1
+		for _, l := range logs {
+			if ts := l.(map[int16]interface{})[1].(int64); ts < start || ts > end {
+				t.Fatalf("log timestamp %d out of span [%d, %d]", ts, start, end)
+			}
+		}
+		fields := logs[0].(map[int16]interface{})[2].([]interface{})
+		if len(fields) != 2 || fields[0].(map[int16]interface{})[3] != "retry" || fields[1].(map[int16]interface{})[6] != int64(2) {
+			t.Fatalf("unexpected log fields %v", fields)
+		}
+		fields = logs[1].(map[int16]interface{})[2].([]interface{})
+		if len(fields) != 3 || fields[1].(map[int16]interface{})[3] != "EOF" || fields[2].(map[int16]interface{})[3] != "*errors.errorString" {
+			t.Fatalf("unexpected log fields %v", fields)
+		}
+	}
+}
+
+func TestThriftCompactEncodeTypedTags(t *testing.T) {
+	_, handle := minitrace.StartRootSpan(context.Background(), "root", minitrace.TraceID{Low: 10010}, 0, nil)
+	handle.AddProperty("string", "value")
+	handle.AddPropertyInt("int", -42)
+	handle.AddPropertyBool("true", true)
+	handle.AddPropertyBool("false", false)
+	handle.AddPropertyFloat("float", 0.5)
+	handle.AddPropertyDuration("duration", time.Millisecond)
+	mtrace, _ := handle.Collect()
+
+	buf := bytes.NewBuffer(nil)
+	if err := ThriftCompactEncode(buf, MiniSpansToJaegerTrace("minitrace-test", mtrace)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][2]interface{}{
+		"string":   {int64(TagString), "value"},
+		"int":      {int64(TagLong), int64(-42)},
+		"true":     {int64(TagBool), true},
+		"false":    {int64(TagBool), false},
+		"float":    {int64(TagDouble), 0.5},
+		"duration": {int64(TagLong), int64(time.Millisecond)},
+	}
+	tags := decodeEmitBatch(t, buf.Bytes())[0][10].([]interface{})
+	if len(tags) != len(expected) {
+		t.Fatalf("expected %d tags, got %d", len(expected), len(tags))
+	}
+	for _, tag := range tags {
+		tag := tag.(map[int16]interface{})
+		e := expected[tag[1].(string)]
+		var value interface{}
+		for id := int16(3); id <= 6; id++ {
+			if v, ok := tag[id]; ok {
+				value = v
+			}
+		}
+		if tag[2] != e[0] || value != e[1] {
+			t.Fatalf("unexpected tag %v", tag)
+		}
+	}
+}
+
+func TestThriftCompactEncodeReferences(t *testing.T) {
+	ctx, handle := minitrace.StartRootSpan(context.Background(), "root", minitrace.TraceID{Low: 10010}, 0, nil)
+	child := minitrace.StartSpan(ctx, "child")
+	child.Finish()
+	async := minitrace.StartSpan(ctx, "async")
+	async.SetRefType(minitrace.FollowsFrom)
+	async.Finish()
+	mtrace, _ := handle.Collect()
+
+	buf := bytes.NewBuffer(nil)
+	if err := ThriftCompactEncode(buf, MiniSpansToJaegerTrace("minitrace-test", mtrace)); err != nil {
+		t.Fatal(err)
+	}
+
+	var rootID int64
+	refTypes := map[string]int64{}
+	for _, span := range decodeEmitBatch(t, buf.Bytes()) {
+		if span[7] != int64(1) {
+			t.Fatalf("expected the sampled flag, got %v", span[7])
+		}
+		if span[5] == "root" {
+			rootID = span[3].(int64)
+			if _, ok := span[6]; ok {
+				t.Fatalf("expected no references on the root span")
+			}
+			continue
+		}
+		ref := span[6].([]interface{})[0].(map[int16]interface{})
+		if ref[4] != span[4] {
+			t.Fatalf("expected the reference to point at the parent")
+		}
+		refTypes[span[5].(string)] = ref[1].(int64)
+	}
+	if rootID == 0 || refTypes["child"] != int64(RefChildOf) || refTypes["async"] != int64(RefFollowsFrom) {
+		t.Fatalf("unexpected references %v", refTypes)
+	}
+}
@@ -19,10 +19,42 @@ type Span struct {
 	StartUnixTimeUs int64
 	DurationUs      int64
 	OperationName   string
-	Tags            []struct {
-		Key   string
-		Value string
-	}
+	RefType         RefType // Relation to the parent, ignored if `ParentID` is 0
+	Tags            []Tag
+	Logs            []Log
+}
+
+// RefType is the `SpanRefType` enum in jaeger.thrift.
+type RefType int32
+
+const (
+	RefChildOf     RefType = 0
+	RefFollowsFrom RefType = 1
+)
+
+// Tag is a key-value pair. Only the value field matching `Type` is encoded.
+type Tag struct {
+	Key   string
+	Type  TagType
+	Value string
+	Long  int64
+	Bool  bool
+	Float float64
+}
+
+// TagType is the `TagType` enum in jaeger.thrift.
+type TagType int32
+
+const (
+	TagString TagType = 0
+	TagDouble TagType = 1
+	TagBool   TagType = 2
+	TagLong   TagType = 3
+)
+
+type Log struct {
+	UnixTimeUs int64
+	Fields     []Tag
 }
 
 type Trace struct {
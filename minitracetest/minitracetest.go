@@ -0,0 +1,214 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package minitracetest records traces in memory and checks their shape in tests of instrumented
+// code.
+//
+// Spans are addressed by paths of events from a root span, such as "root/child/grandchild". Event
+// names may contain slashes themselves, e.g. "grpc.Service/Method".
+package minitracetest
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tikv/minitrace-go"
+)
+
+// Recorder keeps traces in memory. It is both a `reporter.Exporter` and a `reporter.Reporter`, and
+// is safe for concurrent use.
+type Recorder struct {
+	mu     sync.Mutex
+	traces []minitrace.Trace
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+func (r *Recorder) Export(ctx context.Context, traces []minitrace.Trace) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.traces = append(r.traces, traces...)
+	return nil
+}
+
+func (r *Recorder) Report(trace minitrace.Trace) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.traces = append(r.traces, trace)
+	return true
+}
+
+// Traces returns the traces recorded so far, in the order they were reported.
+func (r *Recorder) Traces() []minitrace.Trace {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]minitrace.Trace(nil), r.traces...)
+}
+
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.traces = nil
+}
+
+// ManualClock is a `minitrace.Clock` which only moves when advanced, for exact timing in tests:
+//
+//	clock := minitracetest.NewManualClock(time.Unix(0, 0))
+//	ctx, root := minitrace.StartRootSpan(ctx, "root", traceID, 0, nil, minitrace.WithClock(clock))
+//	clock.Advance(time.Millisecond)
+type ManualClock struct {
+	// Accessed atomically, kept first for 64-bit alignment on 32-bit platforms.
+	elapsedNs   uint64
+	startUnixNs uint64
+}
+
+var _ minitrace.Clock = (*ManualClock)(nil)
+
+// NewManualClock returns a clock stopped at `now`.
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{startUnixNs: uint64(now.UnixNano())}
+}
+
+func (c *ManualClock) Advance(d time.Duration) {
+	atomic.AddUint64(&c.elapsedNs, uint64(d))
+}
+
+func (c *ManualClock) MonotonicNs() uint64 {
+	return atomic.LoadUint64(&c.elapsedNs)
+}
+
+func (c *ManualClock) UnixNs() uint64 {
+	return c.startUnixNs + atomic.LoadUint64(&c.elapsedNs)
+}
+
+// Finds the first node in begin order matching the path below `nodes`.
+func find(nodes []*minitrace.SpanNode, path string) *minitrace.SpanNode {
+	for _, node := range nodes {
+		event := node.Span.Event
+		if path == event {
+			return node
+		}
+		if strings.HasPrefix(path, event+"/") {
+			if found := find(node.Children, path[len(event)+1:]); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// Finds the node at the path from a root, or from an orphan whose parent never finished.
+func findInTree(tree minitrace.TraceTree, path string) *minitrace.SpanNode {
+	if node := find(tree.Roots, path); node != nil {
+		return node
+	}
+	return find(tree.Orphans, path)
+}
+
+// FindSpan returns the span at the path, or false if there is none.
+func FindSpan(trace minitrace.Trace, path string) (minitrace.Span, bool) {
+	if node := findInTree(trace.Tree(), path); node != nil {
+		return node.Span, true
+	}
+	return minitrace.Span{}, false
+}
+
+// AssertSpan fails the test unless the trace has a span at the path, and returns the span.
+func AssertSpan(t testing.TB, trace minitrace.Trace, path string) minitrace.Span {
+	t.Helper()
+	span, ok := FindSpan(trace, path)
+	if !ok {
+		t.Fatalf("no span at %q in trace:\n%s", path, trace.Tree())
+	}
+	return span
+}
+
+// AssertNoSpan fails the test if the trace has a span at the path.
+func AssertNoSpan(t testing.TB, trace minitrace.Trace, path string) {
+	t.Helper()
+	if _, ok := FindSpan(trace, path); ok {
+		t.Fatalf("unexpected span at %q", path)
+	}
+}
+
+// AssertProperty fails the test unless the span has a property with the key and value, whatever
+// its type, compared as formatted by `Property.ValueString`.
+func AssertProperty(t testing.TB, span minitrace.Span, key, value string) {
+	t.Helper()
+	for _, property := range span.Properties {
+		if property.Key == key {
+			if actual := property.ValueString(); actual != value {
+				t.Fatalf("span %q has property %q = %q, expected %q", span.Event, key, actual, value)
+			}
+			return
+		}
+	}
+	t.Fatalf("span %q has no property %q", span.Event, key)
+}
+
+// AssertChildren fails the test unless the children of the span at the path have exactly the
+// events, in begin order.
+func AssertChildren(t testing.TB, trace minitrace.Trace, path string, events ...string) {
+	t.Helper()
+	node := findInTree(trace.Tree(), path)
+	if node == nil {
+		t.Fatalf("no span at %q", path)
+		return
+	}
+
+	actual := make([]string, 0, len(node.Children))
+	for _, child := range node.Children {
+		actual = append(actual, child.Span.Event)
+	}
+	if !equalStrings(actual, events) {
+		t.Fatalf("span %q has children %q, expected %q", path, actual, events)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// AssertBefore fails the test unless span `a` finishes before span `b` begins.
+func AssertBefore(t testing.TB, a, b minitrace.Span) {
+	t.Helper()
+	if end(a) > b.BeginUnixTimeNs {
+		t.Fatalf("span %q does not finish before span %q begins", a.Event, b.Event)
+	}
+}
+
+// AssertOverlap fails the test unless the spans run concurrently for some time.
+func AssertOverlap(t testing.TB, a, b minitrace.Span) {
+	t.Helper()
+	if end(a) <= b.BeginUnixTimeNs || end(b) <= a.BeginUnixTimeNs {
+		t.Fatalf("spans %q and %q do not overlap", a.Event, b.Event)
+	}
+}
+
+func end(span minitrace.Span) uint64 {
+	return span.BeginUnixTimeNs + span.DurationNs
+}
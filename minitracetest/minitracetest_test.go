@@ -0,0 +1,134 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package minitracetest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tikv/minitrace-go"
+)
+
+// Records failures instead of failing the test.
+type fakeT struct {
+	testing.TB
+	failure string
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Fatalf(format string, args ...interface{}) {
+	t.failure = fmt.Sprintf(format, args...)
+}
+
+func newTrace(t *testing.T) minitrace.Trace {
+	ctx, root := minitrace.StartRootSpan(context.Background(), "root", minitrace.TraceID{Low: 1}, 0, nil)
+	root.AddPropertyInt("rows", 3)
+
+	ctx1, first := minitrace.StartSpanWithContext(ctx, "kv.Service/Get")
+	leaf := minitrace.StartSpan(ctx1, "decode")
+	leaf.Finish()
+	first.Finish()
+
+	second := minitrace.StartSpan(ctx, "commit")
+	third := minitrace.StartSpan(ctx, "async")
+	third.Finish()
+	second.Finish()
+
+	recorder := NewRecorder()
+	trace, _ := root.Collect()
+	recorder.Report(trace)
+	traces := recorder.Traces()
+	if len(traces) != 1 {
+		t.Fatalf("expected 1 recorded trace, got %d", len(traces))
+	}
+	return traces[0]
+}
+
+func TestAssertions(t *testing.T) {
+	trace := newTrace(t)
+
+	root := AssertSpan(t, trace, "root")
+	AssertProperty(t, root, "rows", "3")
+	decode := AssertSpan(t, trace, "root/kv.Service/Get/decode")
+	AssertChildren(t, trace, "root", "kv.Service/Get", "commit", "async")
+	AssertChildren(t, trace, "root/commit")
+	AssertNoSpan(t, trace, "root/decode")
+	AssertBefore(t, decode, AssertSpan(t, trace, "root/commit"))
+	AssertOverlap(t, AssertSpan(t, trace, "root/commit"), AssertSpan(t, trace, "root/async"))
+	AssertOverlap(t, root, decode)
+
+	for name, assert := range map[string]func(t testing.TB){
+		"missing span":     func(t testing.TB) { AssertSpan(t, trace, "root/missing") },
+		"unexpected span":  func(t testing.TB) { AssertNoSpan(t, trace, "root/commit") },
+		"missing property": func(t testing.TB) { AssertProperty(t, root, "missing", "") },
+		"wrong property":   func(t testing.TB) { AssertProperty(t, root, "rows", "4") },
+		"wrong children":   func(t testing.TB) { AssertChildren(t, trace, "root", "commit") },
+		"wrong order":      func(t testing.TB) { AssertBefore(t, AssertSpan(t, trace, "root/commit"), decode) },
+		"missing overlap":  func(t testing.TB) { AssertOverlap(t, decode, AssertSpan(t, trace, "root/commit")) },
+	} {
+		ft := &fakeT{TB: t}
+		assert(ft)
+		if ft.failure == "" {
+			t.Fatalf("expected %s to fail", name)
+		}
+	}
+}
+
+func TestAssertSpanFromRemoteParent(t *testing.T) {
+	// Paths start from the root, even if it is the child of a remote parent.
+	trace := minitrace.Trace{Spans: []minitrace.Span{
+		{ID: 1, ParentID: 100, Event: "remote child", BeginUnixTimeNs: 10},
+		{ID: 4, ParentID: 1, Event: "b", BeginUnixTimeNs: 40},
+		{ID: 5, ParentID: 1, Event: "a", BeginUnixTimeNs: 20},
+	}}
+	AssertSpan(t, trace, "remote child/a")
+	AssertChildren(t, trace, "remote child", "a", "b")
+}
+
+func TestManualClock(t *testing.T) {
+	minitrace.SetIDGenerator(minitrace.NewSequentialIDGenerator())
+	defer minitrace.SetIDGenerator(nil)
+
+	clock := NewManualClock(time.Unix(1, 0))
+	ctx, root := minitrace.StartRootSpan(context.Background(), "root", minitrace.TraceID{}, 0, nil, minitrace.WithClock(clock))
+	clock.Advance(time.Millisecond)
+	child := minitrace.StartSpan(ctx, "child")
+	clock.Advance(2 * time.Millisecond)
+	child.AddEvent("retry")
+	clock.Advance(3 * time.Millisecond)
+	child.Finish()
+	clock.Advance(time.Millisecond)
+	trace, _ := root.Collect()
+
+	if trace.TraceID != (minitrace.TraceID{Low: 1}) {
+		t.Fatalf("unexpected trace ID %s", trace.TraceID)
+	}
+	span := AssertSpan(t, trace, "root/child")
+	if span.ID != 2 || span.BeginUnixTimeNs != uint64(time.Second+time.Millisecond) || span.DurationNs != uint64(5*time.Millisecond) {
+		t.Fatalf("unexpected span %+v", span)
+	}
+	if span.Events[0].UnixTimeNs != uint64(time.Second+3*time.Millisecond) {
+		t.Fatalf("unexpected event time %d", span.Events[0].UnixTimeNs)
+	}
+
+	expected := "" +
+		"       0s       7ms  root\n" +
+		"      1ms       5ms    child\n"
+	if actual := trace.Tree().String(); actual != expected {
+		t.Fatalf("unexpected rendering:\n%s", actual)
+	}
+}
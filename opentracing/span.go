@@ -0,0 +1,307 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opentracing
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	ot "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/tikv/minitrace-go"
+)
+
+// Span wraps a minitrace span. Unlike `minitrace.SpanHandle`, it is safe for concurrent use as
+// required by OpenTracing.
+type Span struct {
+	tracer *Tracer
+	ctx    context.Context
+
+	mu      sync.Mutex
+	handle  *minitrace.SpanHandle
+	root    *minitrace.TraceHandle // Set if the span is the root of a trace, sharing `handle`
+	baggage map[string]string
+}
+
+var _ ot.Span = (*Span)(nil)
+
+func (s *Span) Finish() {
+	s.FinishWithOptions(ot.FinishOptions{})
+}
+
+func (s *Span) FinishWithOptions(opts ot.FinishOptions) {
+	s.mu.Lock()
+	for _, record := range opts.LogRecords {
+		s.logFields(record.Fields)
+	}
+	for _, data := range opts.BulkLogData {
+		s.logFields(data.ToLogRecord().Fields)
+	}
+	if !opts.FinishTime.IsZero() {
+		s.overrideTime(opts.FinishTime, false)
+	}
+
+	if s.root == nil {
+		s.handle.Finish()
+		s.mu.Unlock()
+		return
+	}
+
+	trace, attachment := s.root.Collect()
+	s.mu.Unlock()
+
+	if times, ok := attachment.(*explicitTimes); ok {
+		times.apply(trace.Spans)
+	}
+	if len(trace.Spans) > 0 {
+		s.tracer.report(trace)
+	}
+}
+
+// Explicit start and finish times of the spans of a trace, keyed by span ID. minitrace times spans
+// itself, so they are applied to the collected trace. It is held by the attachment of the trace.
+type explicitTimes struct {
+	start  map[uint64]time.Time
+	finish map[uint64]time.Time
+}
+
+// Records an explicit start or finish time for the span.
+func (s *Span) overrideTime(t time.Time, start bool) {
+	spanID, _, ok := minitrace.CurrentID(s.ctx)
+	if !ok {
+		return
+	}
+	minitrace.AccessAttachment(s.ctx, func(attachment interface{}) {
+		times, ok := attachment.(*explicitTimes)
+		if !ok {
+			return
+		}
+		if start {
+			if times.start == nil {
+				times.start = map[uint64]time.Time{}
+			}
+			times.start[spanID] = t
+		} else {
+			if times.finish == nil {
+				times.finish = map[uint64]time.Time{}
+			}
+			times.finish[spanID] = t
+		}
+	})
+}
+
+func (times *explicitTimes) apply(spans []minitrace.Span) {
+	for i := range spans {
+		span := &spans[i]
+		begin := span.BeginUnixTimeNs
+		end := begin + span.DurationNs
+		if t, ok := times.start[span.ID]; ok {
+			begin = uint64(t.UnixNano())
+		}
+		if t, ok := times.finish[span.ID]; ok {
+			end = uint64(t.UnixNano())
+		}
+		if end < begin {
+			end = begin
+		}
+		span.BeginUnixTimeNs = begin
+		span.DurationNs = end - begin
+	}
+}
+
+func (s *Span) Context() ot.SpanContext {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return SpanContext{ctx: s.ctx, baggage: s.baggage}
+}
+
+func (s *Span) SetOperationName(operationName string) ot.Span {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handle.SetEvent(operationName)
+	return s
+}
+
+func (s *Span) SetTag(key string, value interface{}) ot.Span {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setTag(key, value)
+	return s
+}
+
+func (s *Span) setTag(key string, value interface{}) {
+	if key == string(ext.Error) {
+		if b, ok := value.(bool); ok {
+			if b {
+				s.handle.SetStatus(minitrace.StatusError, "")
+			}
+			return
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		s.handle.AddProperty(key, v)
+	case bool:
+		s.handle.AddPropertyBool(key, v)
+	case int:
+		s.handle.AddPropertyInt(key, int64(v))
+	case int8:
+		s.handle.AddPropertyInt(key, int64(v))
+	case int16:
+		s.handle.AddPropertyInt(key, int64(v))
+	case int32:
+		s.handle.AddPropertyInt(key, int64(v))
+	case int64:
+		s.handle.AddPropertyInt(key, v)
+	case uint8:
+		s.handle.AddPropertyInt(key, int64(v))
+	case uint16:
+		s.handle.AddPropertyInt(key, int64(v))
+	case uint32:
+		s.handle.AddPropertyInt(key, int64(v))
+	case float32:
+		s.handle.AddPropertyFloat(key, float64(v))
+	case float64:
+		s.handle.AddPropertyFloat(key, v)
+	case time.Duration:
+		s.handle.AddPropertyDuration(key, v)
+	default:
+		s.handle.AddProperty(key, fmt.Sprint(v))
+	}
+}
+
+// LogFields records the fields as a span event named by the "event" field, or "log" if absent. An
+// error logged with `log.Error` marks the span as failed.
+func (s *Span) LogFields(fields ...log.Field) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logFields(fields)
+}
+
+func (s *Span) logFields(fields []log.Field) {
+	enc := propertyEncoder{name: "log"}
+	for _, field := range fields {
+		if err, ok := field.Value().(error); ok && field.Key() == "error" {
+			s.handle.SetError(err)
+		}
+		field.Marshal(&enc)
+	}
+	s.handle.AddEvent(enc.name, enc.properties...)
+}
+
+func (s *Span) LogKV(alternatingKeyValues ...interface{}) {
+	fields, err := log.InterleavedKVToFields(alternatingKeyValues...)
+	if err != nil {
+		s.LogFields(log.Error(err), log.String("function", "LogKV"))
+		return
+	}
+	s.LogFields(fields...)
+}
+
+func (s *Span) SetBaggageItem(restrictedKey, value string) ot.Span {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Baggage is shared with the parent and children, so copy on write.
+	baggage := make(map[string]string, len(s.baggage)+1)
+	for k, v := range s.baggage {
+		baggage[k] = v
+	}
+	baggage[restrictedKey] = value
+	s.baggage = baggage
+	return s
+}
+
+func (s *Span) BaggageItem(restrictedKey string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.baggage[restrictedKey]
+}
+
+func (s *Span) Tracer() ot.Tracer {
+	return s.tracer
+}
+
+// Deprecated: use LogFields or LogKV.
+func (s *Span) LogEvent(event string) {
+	s.Log(ot.LogData{Event: event})
+}
+
+// Deprecated: use LogFields or LogKV.
+func (s *Span) LogEventWithPayload(event string, payload interface{}) {
+	s.Log(ot.LogData{Event: event, Payload: payload})
+}
+
+// Deprecated: use LogFields or LogKV.
+func (s *Span) Log(data ot.LogData) {
+	s.LogFields(data.ToLogRecord().Fields...)
+}
+
+// Converts log fields to minitrace properties, picking the "event" field as the event name.
+type propertyEncoder struct {
+	name       string
+	properties []minitrace.Property
+}
+
+func (e *propertyEncoder) EmitString(key, value string) {
+	if key == "event" {
+		e.name = value
+		return
+	}
+	e.properties = append(e.properties, minitrace.StringProperty(key, value))
+}
+
+func (e *propertyEncoder) EmitBool(key string, value bool) {
+	e.properties = append(e.properties, minitrace.BoolProperty(key, value))
+}
+
+func (e *propertyEncoder) EmitInt(key string, value int) {
+	e.properties = append(e.properties, minitrace.IntProperty(key, int64(value)))
+}
+
+func (e *propertyEncoder) EmitInt32(key string, value int32) {
+	e.properties = append(e.properties, minitrace.IntProperty(key, int64(value)))
+}
+
+func (e *propertyEncoder) EmitInt64(key string, value int64) {
+	e.properties = append(e.properties, minitrace.IntProperty(key, value))
+}
+
+func (e *propertyEncoder) EmitUint32(key string, value uint32) {
+	e.properties = append(e.properties, minitrace.IntProperty(key, int64(value)))
+}
+
+func (e *propertyEncoder) EmitUint64(key string, value uint64) {
+	e.properties = append(e.properties, minitrace.StringProperty(key, fmt.Sprint(value)))
+}
+
+func (e *propertyEncoder) EmitFloat32(key string, value float32) {
+	e.properties = append(e.properties, minitrace.FloatProperty(key, float64(value)))
+}
+
+func (e *propertyEncoder) EmitFloat64(key string, value float64) {
+	e.properties = append(e.properties, minitrace.FloatProperty(key, value))
+}
+
+func (e *propertyEncoder) EmitObject(key string, value interface{}) {
+	e.EmitString(key, fmt.Sprint(value))
+}
+
+func (e *propertyEncoder) EmitLazyLogger(value log.LazyLogger) {
+	value(e)
+}
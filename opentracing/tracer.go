@@ -0,0 +1,210 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package opentracing implements `opentracing.Tracer` on top of minitrace, so code instrumented with
+// OpenTracing records into minitrace traces.
+package opentracing
+
+import (
+	"context"
+	"strings"
+
+	ot "github.com/opentracing/opentracing-go"
+	"github.com/tikv/minitrace-go"
+	"github.com/tikv/minitrace-go/propagation"
+	"github.com/tikv/minitrace-go/reporter"
+)
+
+const baggagePrefix = "ot-baggage-"
+
+// Tracer starts a minitrace root span for every OpenTracing span without a local parent. The trace
+// is collected and reported when the root span finishes. Explicit start and finish times, e.g. of
+// replayed spans, replace the times measured by minitrace once the trace is collected.
+type Tracer struct {
+	report      func(trace minitrace.Trace)
+	rootOptions []minitrace.RootOption
+}
+
+var _ ot.Tracer = (*Tracer)(nil)
+
+// NewTracer returns a tracer reporting finished traces to `report`. A nil `report` hands the traces
+// to the global reporter, see `reporter.Report`. The options apply to the traces started by the
+// tracer.
+func NewTracer(report func(trace minitrace.Trace), opts ...minitrace.RootOption) *Tracer {
+	if report == nil {
+		report = func(trace minitrace.Trace) {
+			reporter.Report(trace)
+		}
+	}
+	return &Tracer{report: report, rootOptions: opts}
+}
+
+func (t *Tracer) StartSpan(operationName string, opts ...ot.StartSpanOption) ot.Span {
+	var options ot.StartSpanOptions
+	for _, opt := range opts {
+		opt.Apply(&options)
+	}
+
+	// Only the first reference to a span of this tracer is honored, as minitrace spans have one parent.
+	var parent *SpanContext
+	var refType minitrace.RefType
+	for _, ref := range options.References {
+		if sc, ok := ref.ReferencedContext.(SpanContext); ok && sc.ctx != nil {
+			parent = &sc
+			if ref.Type == ot.FollowsFromRef {
+				refType = minitrace.FollowsFrom
+			}
+			break
+		}
+	}
+
+	s := &Span{tracer: t}
+	if parent != nil {
+		s.baggage = parent.baggage
+	}
+
+	ctx := contextOf(parent)
+	if _, _, ok := minitrace.CurrentID(ctx); ok {
+		var handle minitrace.SpanHandle
+		s.ctx, handle = minitrace.StartSpanWithContext(ctx, operationName)
+		handle.SetRefType(refType)
+		s.handle = &handle
+	} else {
+		// No local parent, start a new trace, joining the remote parent if any.
+		var root minitrace.TraceHandle
+		s.ctx, root = minitrace.StartRootSpan(ctx, operationName, minitrace.TraceID{}, 0, &explicitTimes{}, t.rootOptions...)
+		s.root = &root
+		s.handle = &root.SpanHandle
+	}
+	if !options.StartTime.IsZero() {
+		s.overrideTime(options.StartTime, true)
+	}
+
+	for k, v := range options.Tags {
+		s.setTag(k, v)
+	}
+	return s
+}
+
+func contextOf(sc *SpanContext) context.Context {
+	if sc == nil {
+		return context.Background()
+	}
+	return sc.ctx
+}
+
+// Inject writes the span context as W3C Trace Context headers, plus `ot-baggage-` prefixed baggage.
+func (t *Tracer) Inject(sm ot.SpanContext, format interface{}, carrier interface{}) error {
+	sc, ok := sm.(SpanContext)
+	if !ok || sc.ctx == nil {
+		return ot.ErrInvalidSpanContext
+	}
+
+	switch format {
+	case ot.TextMap, ot.HTTPHeaders:
+	default:
+		return ot.ErrUnsupportedFormat
+	}
+	writer, ok := carrier.(ot.TextMapWriter)
+	if !ok {
+		return ot.ErrInvalidCarrier
+	}
+
+	if _, _, ok := minitrace.CurrentID(sc.ctx); ok {
+		propagation.Inject(sc.ctx, writerCarrier{writer})
+	} else {
+		// An extracted span context is forwarded as it was received.
+		for k, v := range sc.remote {
+			writer.Set(k, v)
+		}
+	}
+	for k, v := range sc.baggage {
+		writer.Set(baggagePrefix+k, v)
+	}
+	return nil
+}
+
+func (t *Tracer) Extract(format interface{}, carrier interface{}) (ot.SpanContext, error) {
+	switch format {
+	case ot.TextMap, ot.HTTPHeaders:
+	default:
+		return nil, ot.ErrUnsupportedFormat
+	}
+	reader, ok := carrier.(ot.TextMapReader)
+	if !ok {
+		return nil, ot.ErrInvalidCarrier
+	}
+
+	// Header names are case-insensitive, so keys are compared in lowercase.
+	fields := propagation.MapCarrier{}
+	var baggage map[string]string
+	err := reader.ForeachKey(func(key, val string) error {
+		key = strings.ToLower(key)
+		if strings.HasPrefix(key, baggagePrefix) {
+			if baggage == nil {
+				baggage = map[string]string{}
+			}
+			baggage[strings.TrimPrefix(key, baggagePrefix)] = val
+			return nil
+		}
+		fields[key] = val
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := propagation.Extract(context.Background(), fields)
+	if _, ok := minitrace.RemoteSpanContextFromContext(ctx); !ok {
+		return nil, ot.ErrSpanContextNotFound
+	}
+	remote := propagation.MapCarrier{propagation.TraceParentHeader: fields.Get(propagation.TraceParentHeader)}
+	if state := fields.Get(propagation.TraceStateHeader); state != "" {
+		remote.Set(propagation.TraceStateHeader, state)
+	}
+	return SpanContext{ctx: ctx, baggage: baggage, remote: remote}, nil
+}
+
+// Adapts `opentracing.TextMapWriter` to `propagation.TextMapCarrier`.
+type writerCarrier struct {
+	ot.TextMapWriter
+}
+
+func (writerCarrier) Get(string) string {
+	return ""
+}
+
+// SpanContext is the propagated part of a span: the context carrying the minitrace span, or the
+// remote parent for extracted span contexts, and the baggage.
+type SpanContext struct {
+	ctx     context.Context
+	baggage map[string]string
+	// The W3C Trace Context headers of an extracted span context.
+	remote propagation.MapCarrier
+}
+
+var _ ot.SpanContext = SpanContext{}
+
+func (sc SpanContext) ForeachBaggageItem(handler func(k, v string) bool) {
+	for k, v := range sc.baggage {
+		if !handler(k, v) {
+			return
+		}
+	}
+}
+
+// Context returns a context carrying the span, to be passed to minitrace APIs such as
+// `minitrace.StartSpan`.
+func (sc SpanContext) Context() context.Context {
+	return sc.ctx
+}
@@ -0,0 +1,157 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opentracing
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	ot "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/tikv/minitrace-go"
+)
+
+func TestTracer(t *testing.T) {
+	var traces []minitrace.Trace
+	tracer := NewTracer(func(trace minitrace.Trace) {
+		traces = append(traces, trace)
+	})
+
+	root := tracer.StartSpan("root", ot.Tag{Key: "component", Value: "test"})
+	child := tracer.StartSpan("child", ot.ChildOf(root.Context()))
+	child.SetTag("rows", 42)
+	child.LogFields(log.String("event", "retry"), log.Int("attempt", 2))
+	child.LogFields(log.Error(errors.New("region error")))
+	child.Finish()
+	async := tracer.StartSpan("async", ot.FollowsFrom(root.Context()))
+	async.SetOperationName("renamed")
+	async.Finish()
+
+	if len(traces) != 0 {
+		t.Fatalf("expected traces to be reported when the root finishes")
+	}
+	root.Finish()
+	if len(traces) != 1 || len(traces[0].Spans) != 3 {
+		t.Fatalf("expected 1 trace with 3 spans, got %v", traces)
+	}
+
+	spans := map[string]minitrace.Span{}
+	for _, span := range traces[0].Spans {
+		spans[span.Event] = span
+	}
+	if p := spans["root"].Properties; len(p) != 1 || p[0].Value != "test" {
+		t.Fatalf("unexpected root properties %v", p)
+	}
+	c := spans["child"]
+	if c.ParentID != spans["root"].ID || c.RefType != minitrace.ChildOf {
+		t.Fatalf("expected the child to be a child of the root")
+	}
+	if len(c.Properties) != 1 || c.Properties[0].Type != minitrace.PropertyInt || c.Properties[0].Int() != 42 {
+		t.Fatalf("unexpected child properties %v", c.Properties)
+	}
+	if len(c.Events) != 2 || c.Events[0].Name != "retry" || c.Events[0].Properties[0].Int() != 2 {
+		t.Fatalf("unexpected child events %v", c.Events)
+	}
+	if c.StatusCode != minitrace.StatusError || c.StatusMessage != "region error" {
+		t.Fatalf("unexpected child status %s %q", c.StatusCode, c.StatusMessage)
+	}
+	if a, ok := spans["renamed"]; !ok || a.RefType != minitrace.FollowsFrom {
+		t.Fatalf("expected the renamed span to follow from the root")
+	}
+}
+
+func TestInjectExtract(t *testing.T) {
+	var traces []minitrace.Trace
+	tracer := NewTracer(func(trace minitrace.Trace) {
+		traces = append(traces, trace)
+	})
+
+	client := tracer.StartSpan("client")
+	client.SetBaggageItem("user", "alice")
+	header := http.Header{}
+	if err := tracer.Inject(client.Context(), ot.HTTPHeaders, ot.HTTPHeadersCarrier(header)); err != nil {
+		t.Fatal(err)
+	}
+
+	sc, err := tracer.Extract(ot.HTTPHeaders, ot.HTTPHeadersCarrier(header))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A proxy forwards the extracted span context without starting a span.
+	forwarded := http.Header{}
+	if err := tracer.Inject(sc, ot.HTTPHeaders, ot.HTTPHeadersCarrier(forwarded)); err != nil {
+		t.Fatal(err)
+	}
+	if forwarded.Get("traceparent") != header.Get("traceparent") || forwarded.Get("ot-baggage-user") != "alice" {
+		t.Fatalf("expected the span context to be forwarded, got %v", forwarded)
+	}
+
+	server := tracer.StartSpan("server", ot.ChildOf(sc))
+	if server.BaggageItem("user") != "alice" {
+		t.Fatalf("expected baggage to be propagated")
+	}
+	server.Finish()
+	client.Finish()
+
+	if len(traces) != 2 || traces[0].TraceID != traces[1].TraceID {
+		t.Fatalf("expected 2 traces sharing the trace ID, got %v", traces)
+	}
+	if traces[0].Spans[0].ParentID != traces[1].Spans[0].ID {
+		t.Fatalf("expected the server span to be a child of the client span")
+	}
+
+	if _, err := tracer.Extract(ot.HTTPHeaders, ot.HTTPHeadersCarrier(http.Header{})); err != ot.ErrSpanContextNotFound {
+		t.Fatalf("expected %v, got %v", ot.ErrSpanContextNotFound, err)
+	}
+	if err := tracer.Inject(client.Context(), ot.Binary, nil); err != ot.ErrUnsupportedFormat {
+		t.Fatalf("expected %v, got %v", ot.ErrUnsupportedFormat, err)
+	}
+}
+
+func TestExplicitTimes(t *testing.T) {
+	var traces []minitrace.Trace
+	tracer := NewTracer(func(trace minitrace.Trace) {
+		traces = append(traces, trace)
+	})
+
+	start := time.Unix(1600000000, 0)
+	root := tracer.StartSpan("root", ot.StartTime(start))
+	child := tracer.StartSpan("child", ot.ChildOf(root.Context()), ot.StartTime(start.Add(time.Second)))
+	child.FinishWithOptions(ot.FinishOptions{FinishTime: start.Add(3 * time.Second)})
+	measured := tracer.StartSpan("measured", ot.ChildOf(root.Context()))
+	measured.Finish()
+	root.FinishWithOptions(ot.FinishOptions{FinishTime: start.Add(5 * time.Second)})
+
+	if len(traces) != 1 || len(traces[0].Spans) != 3 {
+		t.Fatalf("expected 1 trace with 3 spans, got %v", traces)
+	}
+	for _, span := range traces[0].Spans {
+		switch span.Event {
+		case "root":
+			if span.BeginUnixTimeNs != uint64(start.UnixNano()) || span.DurationNs != uint64(5*time.Second) {
+				t.Fatalf("unexpected root timing %d+%d", span.BeginUnixTimeNs, span.DurationNs)
+			}
+		case "child":
+			if span.BeginUnixTimeNs != uint64(start.Add(time.Second).UnixNano()) || span.DurationNs != uint64(2*time.Second) {
+				t.Fatalf("unexpected child timing %d+%d", span.BeginUnixTimeNs, span.DurationNs)
+			}
+		case "measured":
+			if span.BeginUnixTimeNs < uint64(time.Now().Add(-time.Minute).UnixNano()) {
+				t.Fatalf("expected the span without explicit times to keep its measured timing")
+			}
+		}
+	}
+}
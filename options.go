@@ -0,0 +1,95 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package minitrace
+
+import (
+	"context"
+	"runtime/pprof"
+	rtrace "runtime/trace"
+)
+
+// RootOption configures a trace started by `StartRootSpan`. Options apply to all spans of the trace.
+type RootOption func(*rootOptions)
+
+type rootOptions struct {
+	profileLabels bool
+	runtimeTrace  bool
+	clock         Clock
+}
+
+// Keys of the profile labels set by `WithProfileLabels`.
+const (
+	ProfileLabelSpanEvent = "span_event"
+	ProfileLabelTraceID   = "trace_id"
+)
+
+// WithProfileLabels sets `runtime/pprof` labels with the event of the span and the trace ID on the
+// goroutine while a span started by `StartRootSpan` or `StartSpanWithContext` is active, so CPU
+// profiles attribute samples to span events. `Finish` restores the labels of the parent span, so it
+// must be called on the goroutine which started the span. Goroutines started within a span
+// inherit its labels.
+func WithProfileLabels() RootOption {
+	return func(opts *rootOptions) {
+		opts.profileLabels = true
+	}
+}
+
+// Returns ctx with the profile labels of a span, which are also set on the current goroutine.
+func withProfileLabels(ctx context.Context, traceCtx *traceContext, event string) context.Context {
+	ctx = pprof.WithLabels(ctx, pprof.Labels(
+		ProfileLabelSpanEvent, event,
+		ProfileLabelTraceID, traceCtx.traceIDString,
+	))
+	pprof.SetGoroutineLabels(ctx)
+	return ctx
+}
+
+// WithRuntimeTrace mirrors the trace into `runtime/trace` while an execution trace is being
+// captured, e.g. by `go test -trace`: the root span opens a task, and every span opens a region
+// named after its event, to be viewed alongside scheduler and GC events in `go tool trace`. As
+// regions are per goroutine, `Finish` must be called on the goroutine which started the span.
+// Spans started while no execution trace is captured cost nothing more.
+func WithRuntimeTrace() RootOption {
+	return func(opts *rootOptions) {
+		opts.runtimeTrace = true
+	}
+}
+
+// WithClock times the spans of the trace by the clock instead of the runtime, e.g. to get exact
+// durations in tests.
+func WithClock(clock Clock) RootOption {
+	return func(opts *rootOptions) {
+		opts.clock = clock
+	}
+}
+
+// Work to do when a span finishes, for the options of the trace.
+type spanHooks struct {
+	// Context holding the profile labels of the parent, see `WithProfileLabels`.
+	labelsToRestore context.Context
+	region          *rtrace.Region
+	task            *rtrace.Task
+}
+
+func (h *spanHooks) finish() {
+	if h.region != nil {
+		h.region.End()
+	}
+	if h.task != nil {
+		h.task.End()
+	}
+	if h.labelsToRestore != nil {
+		pprof.SetGoroutineLabels(h.labelsToRestore)
+	}
+}
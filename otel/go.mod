@@ -0,0 +1,11 @@
+module github.com/tikv/minitrace-go/otel
+
+go 1.25.0
+
+require (
+	github.com/tikv/minitrace-go v0.0.0-20261017135809-0305372f147c
+	go.opentelemetry.io/otel v1.44.0
+	go.opentelemetry.io/otel/trace v1.44.0
+)
+
+require github.com/cespare/xxhash/v2 v2.3.0 // indirect
@@ -0,0 +1,215 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package otel implements the OpenTelemetry tracing API on top of minitrace. Spans started by code
+// instrumented with OpenTelemetry become children of the minitrace span active in the context, and
+// are collected along with the minitrace trace. Outside of a minitrace trace, they are no-ops, and
+// so are spans started with `trace.WithNewRoot`, which asks to leave the trace of the context.
+package otel
+
+import (
+	"context"
+	"encoding/binary"
+	"reflect"
+	"sync"
+
+	"github.com/tikv/minitrace-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+type TracerProvider struct {
+	embedded.TracerProvider
+
+	tracer *Tracer
+}
+
+var _ trace.TracerProvider = (*TracerProvider)(nil)
+
+func NewTracerProvider() *TracerProvider {
+	p := &TracerProvider{}
+	p.tracer = &Tracer{provider: p}
+	return p
+}
+
+// Tracer returns the same tracer regardless of the instrumentation scope, since minitrace does not
+// record it.
+func (p *TracerProvider) Tracer(name string, opts ...trace.TracerOption) trace.Tracer {
+	return p.tracer
+}
+
+type Tracer struct {
+	embedded.Tracer
+
+	provider *TracerProvider
+}
+
+var _ trace.Tracer = (*Tracer)(nil)
+
+var noopTracer = noop.NewTracerProvider().Tracer("")
+
+// Start starts a child of the minitrace span active in ctx. Without one, or with `trace.WithNewRoot`,
+// it returns a non-recording span, as the bridge does not start minitrace traces itself; start a
+// root span with `minitrace.StartRootSpan` instead.
+func (t *Tracer) Start(ctx context.Context, spanName string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	if _, _, ok := minitrace.CurrentID(ctx); !ok {
+		return noopTracer.Start(ctx, spanName, opts...)
+	}
+	config := trace.NewSpanStartConfig(opts...)
+	if config.NewRoot() {
+		return noopTracer.Start(ctx, spanName, opts...)
+	}
+
+	s := &Span{provider: t.provider}
+	s.ctx, s.handle = minitrace.StartSpanWithContext(ctx, spanName)
+	s.recording = minitrace.IsSampled(s.ctx)
+	for _, kv := range config.Attributes() {
+		addAttribute(&s.handle, kv)
+	}
+	return trace.ContextWithSpan(s.ctx, s), s
+}
+
+// Span wraps a minitrace span. Unlike `minitrace.SpanHandle`, it is safe for concurrent use as
+// required by OpenTelemetry.
+type Span struct {
+	embedded.Span
+
+	provider  *TracerProvider
+	ctx       context.Context
+	recording bool
+
+	mu     sync.Mutex
+	handle minitrace.SpanHandle
+	ended  bool
+}
+
+var _ trace.Span = (*Span)(nil)
+
+func (s *Span) End(options ...trace.SpanEndOption) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ended = true
+	s.handle.Finish()
+}
+
+func (s *Span) AddEvent(name string, options ...trace.EventOption) {
+	config := trace.NewEventConfig(options...)
+	properties := make([]minitrace.Property, 0, len(config.Attributes()))
+	for _, kv := range config.Attributes() {
+		properties = append(properties, attributeToProperty(kv))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handle.AddEvent(name, properties...)
+}
+
+// AddLink is not supported, as minitrace spans have a single parent.
+func (s *Span) AddLink(link trace.Link) {}
+
+func (s *Span) IsRecording() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.recording && !s.ended
+}
+
+// RecordError records the error as an "exception" event, following the OpenTelemetry semantic
+// conventions. As in OpenTelemetry, it does not change the status of the span.
+func (s *Span) RecordError(err error, options ...trace.EventOption) {
+	if err == nil {
+		return
+	}
+	options = append(options, trace.WithAttributes(
+		attribute.String("exception.type", reflect.TypeOf(err).String()),
+		attribute.String("exception.message", err.Error()),
+	))
+	s.AddEvent("exception", options...)
+}
+
+func (s *Span) SpanContext() trace.SpanContext {
+	spanID, traceID, _ := minitrace.CurrentID(s.ctx)
+
+	var config trace.SpanContextConfig
+	binary.BigEndian.PutUint64(config.TraceID[:8], traceID.High)
+	binary.BigEndian.PutUint64(config.TraceID[8:], traceID.Low)
+	binary.BigEndian.PutUint64(config.SpanID[:], spanID)
+	if s.recording {
+		config.TraceFlags = trace.FlagsSampled
+	}
+	return trace.NewSpanContext(config)
+}
+
+func (s *Span) SetStatus(code codes.Code, description string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch code {
+	case codes.Ok:
+		s.handle.SetStatus(minitrace.StatusOK, "")
+	case codes.Error:
+		s.handle.SetStatus(minitrace.StatusError, description)
+	}
+}
+
+func (s *Span) SetName(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handle.SetEvent(name)
+}
+
+func (s *Span) SetAttributes(kv ...attribute.KeyValue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range kv {
+		addAttribute(&s.handle, a)
+	}
+}
+
+func (s *Span) TracerProvider() trace.TracerProvider {
+	return s.provider
+}
+
+func addAttribute(handle *minitrace.SpanHandle, kv attribute.KeyValue) {
+	key := string(kv.Key)
+	switch kv.Value.Type() {
+	case attribute.BOOL:
+		handle.AddPropertyBool(key, kv.Value.AsBool())
+	case attribute.INT64:
+		handle.AddPropertyInt(key, kv.Value.AsInt64())
+	case attribute.FLOAT64:
+		handle.AddPropertyFloat(key, kv.Value.AsFloat64())
+	case attribute.STRING:
+		handle.AddProperty(key, kv.Value.AsString())
+	default:
+		handle.AddProperty(key, kv.Value.Emit())
+	}
+}
+
+func attributeToProperty(kv attribute.KeyValue) minitrace.Property {
+	key := string(kv.Key)
+	switch kv.Value.Type() {
+	case attribute.BOOL:
+		return minitrace.BoolProperty(key, kv.Value.AsBool())
+	case attribute.INT64:
+		return minitrace.IntProperty(key, kv.Value.AsInt64())
+	case attribute.FLOAT64:
+		return minitrace.FloatProperty(key, kv.Value.AsFloat64())
+	case attribute.STRING:
+		return minitrace.StringProperty(key, kv.Value.AsString())
+	default:
+		return minitrace.StringProperty(key, kv.Value.Emit())
+	}
+}
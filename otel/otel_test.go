@@ -0,0 +1,101 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/tikv/minitrace-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracer(t *testing.T) {
+	tracer := NewTracerProvider().Tracer("test")
+
+	ctx, root := minitrace.StartRootSpan(context.Background(), "root", minitrace.TraceID{High: 1, Low: 2}, 0, nil)
+	ctx, span := tracer.Start(ctx, "otel", trace.WithAttributes(attribute.Int("rows", 42)))
+	if !span.IsRecording() {
+		t.Fatalf("expected the span to be recording")
+	}
+	if sc := span.SpanContext(); sc.TraceID().String() != "00000000000000010000000000000002" || !sc.IsSampled() {
+		t.Fatalf("unexpected span context %v", sc)
+	}
+
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("cached", true))
+	_, nested := tracer.Start(ctx, "nested")
+	nested.RecordError(errors.New("region error"))
+	nested.SetStatus(codes.Error, "failed")
+	nested.End()
+	child := minitrace.StartSpan(ctx, "minitrace")
+	child.Finish()
+	span.AddEvent("retry", trace.WithAttributes(attribute.String("reason", "timeout")))
+	span.End()
+	if span.IsRecording() {
+		t.Fatalf("expected the span to stop recording after end")
+	}
+
+	collected, _ := root.Collect()
+	spans := map[string]minitrace.Span{}
+	for _, span := range collected.Spans {
+		spans[span.Event] = span
+	}
+	if len(spans) != 4 {
+		t.Fatalf("expected 4 spans, got %d", len(spans))
+	}
+	if spans["otel"].ParentID != spans["root"].ID || spans["nested"].ParentID != spans["otel"].ID || spans["minitrace"].ParentID != spans["otel"].ID {
+		t.Fatalf("unexpected span tree %v", spans)
+	}
+	if p := spans["otel"].Properties; len(p) != 2 || p[0].Int() != 42 || !p[1].Bool() {
+		t.Fatalf("unexpected properties %v", p)
+	}
+	if e := spans["otel"].Events; len(e) != 1 || e[0].Name != "retry" || e[0].Properties[0].Value != "timeout" {
+		t.Fatalf("unexpected events %v", e)
+	}
+	if n := spans["nested"]; n.StatusCode != minitrace.StatusError || n.StatusMessage != "failed" || n.Events[0].Name != "exception" {
+		t.Fatalf("unexpected nested span %+v", n)
+	}
+}
+
+func TestTracerWithoutTrace(t *testing.T) {
+	tracer := NewTracerProvider().Tracer("test")
+
+	ctx, span := tracer.Start(context.Background(), "otel")
+	if span.IsRecording() || span.SpanContext().IsValid() {
+		t.Fatalf("expected a no-op span outside of a minitrace trace")
+	}
+	if _, _, ok := minitrace.CurrentID(ctx); ok {
+		t.Fatalf("expected no minitrace span in the context")
+	}
+	span.End()
+}
+
+func TestTracerNewRoot(t *testing.T) {
+	tracer := NewTracerProvider().Tracer("test")
+	ctx, root := minitrace.StartRootSpan(context.Background(), "root", minitrace.TraceID{Low: 1}, 0, nil)
+
+	_, span := tracer.Start(ctx, "detached", trace.WithNewRoot())
+	if span.IsRecording() || span.SpanContext().IsValid() {
+		t.Fatalf("expected a no-op span for a new root")
+	}
+	span.End()
+
+	collected, _ := root.Collect()
+	if len(collected.Spans) != 1 {
+		t.Fatalf("expected the new root not to be recorded in the trace of the context, got %v", collected.Spans)
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/tikv/minitrace-go"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+const ScopeName = "github.com/tikv/minitrace-go"
+
+// HTTPExporter sends traces to an OTLP/HTTP endpoint as binary protobuf, one request per batch.
+type HTTPExporter struct {
+	ServiceName string
+	// Full URL of the traces endpoint, e.g. "http://127.0.0.1:4318/v1/traces".
+	Endpoint string
+	Headers  map[string]string
+	Client   *http.Client
+}
+
+func NewHTTPExporter(serviceName string, endpoint string) *HTTPExporter {
+	return &HTTPExporter{ServiceName: serviceName, Endpoint: endpoint}
+}
+
+func (e *HTTPExporter) Export(ctx context.Context, traces []minitrace.Trace) error {
+	body, err := proto.Marshal(MiniSpansToOTLPRequest(e.ServiceName, traces))
+	if err != nil {
+		return err
+	}
+	return SendHTTP(ctx, body, e.Endpoint, e.Headers, e.Client)
+}
+
+// SendHTTP posts an encoded `ExportTraceServiceRequest`. A nil client means `http.DefaultClient`.
+func SendHTTP(ctx context.Context, body []byte, endpoint string, headers map[string]string, client *http.Client) error {
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("cannot create http request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if code := response.StatusCode; code < 200 || code >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(response.Body, 1000))
+		txt := http.StatusText(code)
+		if len(msg) > 0 {
+			return fmt.Errorf("%s (Status: %s)", msg, txt)
+		}
+		return fmt.Errorf("%s", txt)
+	}
+	return nil
+}
+
+// GRPCExporter sends traces to an OTLP/gRPC endpoint over a connection owned by the caller.
+type GRPCExporter struct {
+	ServiceName string
+	client      coltracepb.TraceServiceClient
+}
+
+func NewGRPCExporter(serviceName string, conn grpc.ClientConnInterface) *GRPCExporter {
+	return &GRPCExporter{
+		ServiceName: serviceName,
+		client:      coltracepb.NewTraceServiceClient(conn),
+	}
+}
+
+func (e *GRPCExporter) Export(ctx context.Context, traces []minitrace.Trace) error {
+	resp, err := e.client.Export(ctx, MiniSpansToOTLPRequest(e.ServiceName, traces))
+	if err != nil {
+		return err
+	}
+	if partial := resp.GetPartialSuccess(); partial.GetRejectedSpans() > 0 {
+		return fmt.Errorf("%d spans rejected: %s", partial.GetRejectedSpans(), partial.GetErrorMessage())
+	}
+	return nil
+}
+
+func MiniSpansToOTLPRequest(
+	serviceName string,
+	traces []minitrace.Trace,
+) *coltracepb.ExportTraceServiceRequest {
+	spanCount := 0
+	for _, trace := range traces {
+		spanCount += len(trace.Spans)
+	}
+	retSpans := make([]*tracepb.Span, 0, spanCount)
+
+	for _, trace := range traces {
+		traceID := traceIDToBytes(trace.TraceID)
+
+		for _, span := range trace.Spans {
+			attributes := make([]*commonpb.KeyValue, 0, len(span.Properties))
+			for _, property := range span.Properties {
+				attributes = append(attributes, propertyToAttribute(property))
+			}
+
+			var events []*tracepb.Span_Event
+			for _, event := range span.Events {
+				eventAttributes := make([]*commonpb.KeyValue, 0, len(event.Properties))
+				for _, property := range event.Properties {
+					eventAttributes = append(eventAttributes, propertyToAttribute(property))
+				}
+				events = append(events, &tracepb.Span_Event{
+					TimeUnixNano: event.UnixTimeNs,
+					Name:         event.Name,
+					Attributes:   eventAttributes,
+				})
+			}
+
+			var parentSpanID []byte
+			if span.ParentID != 0 {
+				parentSpanID = spanIDToBytes(span.ParentID)
+			}
+
+			retSpans = append(retSpans, &tracepb.Span{
+				TraceId:           traceID,
+				SpanId:            spanIDToBytes(span.ID),
+				ParentSpanId:      parentSpanID,
+				Name:              span.Event,
+				Kind:              tracepb.Span_SPAN_KIND_INTERNAL,
+				StartTimeUnixNano: span.BeginUnixTimeNs,
+				EndTimeUnixNano:   span.BeginUnixTimeNs + span.DurationNs,
+				Attributes:        attributes,
+				Events:            events,
+				Status:            statusToOTLP(span),
+			})
+		}
+	}
+
+	return &coltracepb.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{{
+			Resource: &resourcepb.Resource{
+				Attributes: []*commonpb.KeyValue{stringAttribute("service.name", serviceName)},
+			},
+			ScopeSpans: []*tracepb.ScopeSpans{{
+				Scope: &commonpb.InstrumentationScope{Name: ScopeName},
+				Spans: retSpans,
+			}},
+		}},
+	}
+}
+
+func statusToOTLP(span minitrace.Span) *tracepb.Status {
+	switch span.StatusCode {
+	case minitrace.StatusOK:
+		return &tracepb.Status{Code: tracepb.Status_STATUS_CODE_OK}
+	case minitrace.StatusError:
+		return &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR, Message: span.StatusMessage}
+	default:
+		return nil
+	}
+}
+
+func propertyToAttribute(property minitrace.Property) *commonpb.KeyValue {
+	var value commonpb.AnyValue
+	switch property.Type {
+	case minitrace.PropertyInt, minitrace.PropertyDuration:
+		value.Value = &commonpb.AnyValue_IntValue{IntValue: property.Int()}
+	case minitrace.PropertyBool:
+		value.Value = &commonpb.AnyValue_BoolValue{BoolValue: property.Bool()}
+	case minitrace.PropertyFloat:
+		value.Value = &commonpb.AnyValue_DoubleValue{DoubleValue: property.Float()}
+	default:
+		value.Value = &commonpb.AnyValue_StringValue{StringValue: property.Value}
+	}
+	return &commonpb.KeyValue{Key: property.Key, Value: &value}
+}
+
+func stringAttribute(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}},
+	}
+}
+
+func traceIDToBytes(id minitrace.TraceID) []byte {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b[:8], id.High)
+	binary.BigEndian.PutUint64(b[8:], id.Low)
+	return b
+}
+
+func spanIDToBytes(id uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, id)
+	return b
+}
@@ -0,0 +1,161 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/tikv/minitrace-go"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+type collector struct {
+	coltracepb.UnimplementedTraceServiceServer
+
+	mu       sync.Mutex
+	requests []*coltracepb.ExportTraceServiceRequest
+}
+
+func (c *collector) Export(ctx context.Context, req *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = append(c.requests, req)
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil || r.Header.Get("Content-Type") != "application/x-protobuf" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	req := &coltracepb.ExportTraceServiceRequest{}
+	if err := proto.Unmarshal(body, req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	_, _ = c.Export(r.Context(), req)
+}
+
+func newTrace() minitrace.Trace {
+	ctx, handle := minitrace.StartRootSpan(context.Background(), "root", minitrace.TraceID{High: 1, Low: 2}, 0, nil)
+	handle.AddProperty("event1", "root")
+	child := minitrace.StartSpan(ctx, "child")
+	child.AddProperty("event2", "child")
+	child.AddEvent("retry", minitrace.IntProperty("attempt", 2))
+	child.SetError(io.EOF)
+	child.Finish()
+	trace, _ := handle.Collect()
+	return trace
+}
+
+func checkRequest(t *testing.T, req *coltracepb.ExportTraceServiceRequest) {
+	resourceSpans := req.GetResourceSpans()
+	if len(resourceSpans) != 1 {
+		t.Fatalf("expected 1 resource, got %d", len(resourceSpans))
+	}
+	attr := resourceSpans[0].GetResource().GetAttributes()[0]
+	if attr.GetKey() != "service.name" || attr.GetValue().GetStringValue() != "otlp-test" {
+		t.Fatalf("unexpected resource attribute %v", attr)
+	}
+
+	spans := resourceSpans[0].GetScopeSpans()[0].GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	spansByName := map[string]int{}
+	for i, span := range spans {
+		spansByName[span.GetName()] = i
+		if tid := span.GetTraceId(); len(tid) != 16 || tid[7] != 1 || tid[15] != 2 {
+			t.Fatalf("unexpected trace ID %x", tid)
+		}
+		if span.GetEndTimeUnixNano() < span.GetStartTimeUnixNano() {
+			t.Fatalf("span %s ends before it starts", span.GetName())
+		}
+	}
+	root, child := spans[spansByName["root"]], spans[spansByName["child"]]
+	if len(root.GetParentSpanId()) != 0 {
+		t.Fatalf("expected no parent for the root span")
+	}
+	if string(child.GetParentSpanId()) != string(root.GetSpanId()) {
+		t.Fatalf("expected the child to reference the root span")
+	}
+	if status := child.GetStatus(); status.GetCode() != tracepb.Status_STATUS_CODE_ERROR || status.GetMessage() != "EOF" {
+		t.Fatalf("unexpected status %v", status)
+	}
+	if events := child.GetEvents(); len(events) != 1 || events[0].GetName() != "retry" || events[0].GetAttributes()[0].GetValue().GetIntValue() != 2 {
+		t.Fatalf("unexpected events %v", events)
+	}
+	if attr := child.GetAttributes()[0]; attr.GetKey() != "event2" || attr.GetValue().GetStringValue() != "child" {
+		t.Fatalf("unexpected span attribute %v", attr)
+	}
+}
+
+func TestHTTPExporter(t *testing.T) {
+	c := &collector{}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	exporter := NewHTTPExporter("otlp-test", server.URL+"/v1/traces")
+	if err := exporter.Export(context.Background(), []minitrace.Trace{newTrace()}); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(c.requests))
+	}
+	checkRequest(t, c.requests[0])
+}
+
+func TestGRPCExporter(t *testing.T) {
+	c := &collector{}
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	coltracepb.RegisterTraceServiceServer(server, c)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer server.Stop()
+
+	conn, err := grpc.NewClient(
+		"passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	exporter := NewGRPCExporter("otlp-test", conn)
+	if err := exporter.Export(context.Background(), []minitrace.Trace{newTrace()}); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(c.requests))
+	}
+	checkRequest(t, c.requests[0])
+}
@@ -0,0 +1,8 @@
+module github.com/tikv/minitrace-go/pprof
+
+go 1.25.0
+
+require (
+	github.com/google/pprof v0.0.0-20260115054156-294ebfa9ad83
+	github.com/tikv/minitrace-go v0.0.0-20261017135809-0305372f147c
+)
@@ -0,0 +1,149 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pprof attributes CPU profiles to the span events of a trace recorded with
+// `minitrace.WithProfileLabels`.
+package pprof
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/tikv/minitrace-go"
+)
+
+// EventProfile is the CPU time sampled while spans of an event were active.
+type EventProfile struct {
+	Event     string
+	CPU       time.Duration
+	Functions []FunctionProfile
+}
+
+// FunctionProfile is the CPU time of a function: `Flat` in the function itself and `Cum` including
+// its callees.
+type FunctionProfile struct {
+	Name string
+	Flat time.Duration
+	Cum  time.Duration
+}
+
+// Join returns the CPU time of every event of the trace found in the profile, sorted by decreasing
+// CPU time, each with its `top` functions by decreasing flat time. A negative `top` keeps all the
+// functions.
+func Join(p *profile.Profile, trace minitrace.Trace, top int) ([]EventProfile, error) {
+	valueIndex := -1
+	for i, st := range p.SampleType {
+		if st.Type == "cpu" && st.Unit == "nanoseconds" {
+			valueIndex = i
+		}
+	}
+	if valueIndex < 0 {
+		return nil, errors.New("pprof: not a CPU profile")
+	}
+
+	events := make(map[string]struct{}, len(trace.Spans))
+	for i := range trace.Spans {
+		events[trace.Spans[i].Event] = struct{}{}
+	}
+
+	traceID := trace.TraceID.String()
+	type functions map[string]*FunctionProfile
+	profiles := map[string]*EventProfile{}
+	functionsOf := map[string]functions{}
+	for _, sample := range p.Sample {
+		if !hasLabel(sample, minitrace.ProfileLabelTraceID, traceID) {
+			continue
+		}
+		labels := sample.Label[minitrace.ProfileLabelSpanEvent]
+		if len(labels) == 0 {
+			continue
+		}
+		event := labels[0]
+		if _, ok := events[event]; !ok {
+			continue
+		}
+
+		value := time.Duration(sample.Value[valueIndex])
+		ep, ok := profiles[event]
+		if !ok {
+			ep = &EventProfile{Event: event}
+			profiles[event] = ep
+			functionsOf[event] = functions{}
+		}
+		ep.CPU += value
+
+		fns := functionsOf[event]
+		seen := map[string]struct{}{}
+		// Locations are listed from the leaf, and inlined functions from the innermost.
+		for i, location := range sample.Location {
+			for j, line := range location.Line {
+				if line.Function == nil {
+					continue
+				}
+				name := line.Function.Name
+				fp, ok := fns[name]
+				if !ok {
+					fp = &FunctionProfile{Name: name}
+					fns[name] = fp
+				}
+				if i == 0 && j == 0 {
+					fp.Flat += value
+				}
+				// Recursive functions count once toward the cumulative time.
+				if _, ok := seen[name]; !ok {
+					seen[name] = struct{}{}
+					fp.Cum += value
+				}
+			}
+		}
+	}
+
+	result := make([]EventProfile, 0, len(profiles))
+	for event, ep := range profiles {
+		for _, fp := range functionsOf[event] {
+			ep.Functions = append(ep.Functions, *fp)
+		}
+		sort.Slice(ep.Functions, func(i, j int) bool {
+			a, b := ep.Functions[i], ep.Functions[j]
+			if a.Flat != b.Flat {
+				return a.Flat > b.Flat
+			}
+			if a.Cum != b.Cum {
+				return a.Cum > b.Cum
+			}
+			return a.Name < b.Name
+		})
+		if top >= 0 && len(ep.Functions) > top {
+			ep.Functions = ep.Functions[:top]
+		}
+		result = append(result, *ep)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].CPU != result[j].CPU {
+			return result[i].CPU > result[j].CPU
+		}
+		return result[i].Event < result[j].Event
+	})
+	return result, nil
+}
+
+func hasLabel(sample *profile.Sample, key, value string) bool {
+	for _, v := range sample.Label[key] {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pprof
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/tikv/minitrace-go"
+)
+
+func TestJoin(t *testing.T) {
+	traceID := minitrace.TraceID{Low: 1}
+	trace := minitrace.Trace{TraceID: traceID, Spans: []minitrace.Span{
+		{ID: 1, Event: "root"},
+		{ID: 2, ParentID: 1, Event: "decode"},
+	}}
+
+	fn := func(name string) *profile.Function {
+		return &profile.Function{Name: name}
+	}
+	main, decode, hash := fn("main"), fn("decode"), fn("hash")
+	stack := func(fns ...*profile.Function) []*profile.Location {
+		locations := make([]*profile.Location, 0, len(fns))
+		for _, f := range fns {
+			locations = append(locations, &profile.Location{Line: []profile.Line{{Function: f}}})
+		}
+		return locations
+	}
+	labels := func(event string, id minitrace.TraceID) map[string][]string {
+		return map[string][]string{
+			minitrace.ProfileLabelSpanEvent: {event},
+			minitrace.ProfileLabelTraceID:   {id.String()},
+		}
+	}
+	ms := int64(time.Millisecond)
+
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		Sample: []*profile.Sample{
+			{Location: stack(hash, decode, main), Value: []int64{3, 30 * ms}, Label: labels("decode", traceID)},
+			{Location: stack(decode, main), Value: []int64{1, 10 * ms}, Label: labels("decode", traceID)},
+			{Location: stack(main), Value: []int64{2, 20 * ms}, Label: labels("root", traceID)},
+			// Samples of other traces and without labels are ignored.
+			{Location: stack(main), Value: []int64{5, 50 * ms}, Label: labels("root", minitrace.TraceID{Low: 2})},
+			{Location: stack(main), Value: []int64{5, 50 * ms}},
+		},
+	}
+
+	profiles, err := Join(p, trace, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profiles) != 2 || profiles[0].Event != "decode" || profiles[0].CPU != 40*time.Millisecond ||
+		profiles[1].Event != "root" || profiles[1].CPU != 20*time.Millisecond {
+		t.Fatalf("unexpected profiles %+v", profiles)
+	}
+	expected := []FunctionProfile{
+		{Name: "hash", Flat: 30 * time.Millisecond, Cum: 30 * time.Millisecond},
+		{Name: "decode", Flat: 10 * time.Millisecond, Cum: 40 * time.Millisecond},
+	}
+	if fns := profiles[0].Functions; len(fns) != 2 || fns[0] != expected[0] || fns[1] != expected[1] {
+		t.Fatalf("unexpected functions %+v", fns)
+	}
+
+	p.SampleType = []*profile.ValueType{{Type: "inuse_space", Unit: "bytes"}}
+	if _, err := Join(p, trace, 2); err == nil {
+		t.Fatalf("expected an error for a heap profile")
+	}
+}
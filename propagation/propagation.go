@@ -0,0 +1,163 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package propagation carries minitrace IDs across process boundaries using the W3C Trace Context
+// headers (https://www.w3.org/TR/trace-context/).
+package propagation
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/tikv/minitrace-go"
+)
+
+const (
+	TraceParentHeader = "traceparent"
+	TraceStateHeader  = "tracestate"
+
+	maxTraceStateLen = 512
+)
+
+// TextMapCarrier is the storage of propagated fields, e.g. HTTP headers or gRPC metadata.
+type TextMapCarrier interface {
+	Get(key string) string
+	Set(key, value string)
+}
+
+// MapCarrier is a TextMapCarrier backed by a plain map.
+type MapCarrier map[string]string
+
+func (c MapCarrier) Get(key string) string {
+	return c[key]
+}
+
+func (c MapCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+// HeaderCarrier is a TextMapCarrier backed by HTTP headers.
+type HeaderCarrier http.Header
+
+func (c HeaderCarrier) Get(key string) string {
+	return http.Header(c).Get(key)
+}
+
+func (c HeaderCarrier) Set(key, value string) {
+	http.Header(c).Set(key, value)
+}
+
+// Extract reads the remote parent from the carrier and returns a copy of ctx carrying it, ready to
+// be passed to `minitrace.StartRootSpan` with zero trace ID and parent span ID. If the carrier holds
+// no valid `traceparent`, ctx is returned unchanged.
+func Extract(ctx context.Context, carrier TextMapCarrier) context.Context {
+	remote, ok := parseTraceParent(carrier.Get(TraceParentHeader))
+	if !ok {
+		return ctx
+	}
+
+	if state := strings.TrimSpace(carrier.Get(TraceStateHeader)); len(state) <= maxTraceStateLen {
+		remote.TraceState = state
+	}
+	return minitrace.ContextWithRemoteSpanContext(ctx, remote)
+}
+
+// Inject writes the span active in ctx into the carrier. Nothing is written if ctx carries no trace.
+func Inject(ctx context.Context, carrier TextMapCarrier) {
+	spanID, traceID, ok := minitrace.CurrentID(ctx)
+	if !ok || traceID.IsZero() || spanID == 0 {
+		return
+	}
+
+	carrier.Set(TraceParentHeader, formatTraceParent(traceID, spanID, minitrace.IsSampled(ctx)))
+	if remote, ok := minitrace.RemoteSpanContextFromContext(ctx); ok && remote.TraceID == traceID && remote.TraceState != "" {
+		carrier.Set(TraceStateHeader, remote.TraceState)
+	}
+}
+
+// Format: {version:2}-{trace-id:32}-{parent-id:16}-{trace-flags:2}
+const traceParentLen = 55
+
+func parseTraceParent(h string) (remote minitrace.RemoteSpanContext, ok bool) {
+	h = strings.TrimSpace(h)
+	if len(h) < traceParentLen || h[2] != '-' || h[35] != '-' || h[52] != '-' {
+		return
+	}
+
+	version, ok := parseHex(h[0:2])
+	if !ok || version == 0xff {
+		return remote, false
+	}
+	// Version 00 has an exact length, while future versions may append fields.
+	if version == 0 && len(h) != traceParentLen || len(h) > traceParentLen && h[traceParentLen] != '-' {
+		return remote, false
+	}
+
+	traceIDHigh, ok1 := parseHex(h[3:19])
+	traceIDLow, ok2 := parseHex(h[19:35])
+	spanID, ok3 := parseHex(h[36:52])
+	flags, ok4 := parseHex(h[53:55])
+	if !ok1 || !ok2 || !ok3 || !ok4 || traceIDHigh == 0 && traceIDLow == 0 || spanID == 0 {
+		return remote, false
+	}
+
+	remote.TraceID = minitrace.TraceID{High: traceIDHigh, Low: traceIDLow}
+	remote.SpanID = spanID
+	remote.Sampled = flags&0x01 == 0x01
+	return remote, true
+}
+
+func formatTraceParent(traceID minitrace.TraceID, spanID uint64, sampled bool) string {
+	var b strings.Builder
+	b.Grow(traceParentLen)
+	b.WriteString("00-")
+	writeHex(&b, traceID.High)
+	writeHex(&b, traceID.Low)
+	b.WriteByte('-')
+	writeHex(&b, spanID)
+	if sampled {
+		b.WriteString("-01")
+	} else {
+		b.WriteString("-00")
+	}
+	return b.String()
+}
+
+// Only lowercase hex digits are valid in `traceparent`.
+func parseHex(s string) (n uint64, ok bool) {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case '0' <= c && c <= '9':
+			n = n<<4 | uint64(c-'0')
+		case 'a' <= c && c <= 'f':
+			n = n<<4 | uint64(c-'a'+10)
+		default:
+			return 0, false
+		}
+	}
+	return n, true
+}
+
+func writeHex(b *strings.Builder, n uint64) {
+	var buf [8]byte
+	for i := 7; i >= 0; i-- {
+		buf[i] = byte(n)
+		n >>= 8
+	}
+	var out [16]byte
+	hex.Encode(out[:], buf[:])
+	b.Write(out[:])
+}
@@ -0,0 +1,90 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package propagation
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/tikv/minitrace-go"
+)
+
+func TestPropagation(t *testing.T) {
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	header.Set("tracestate", "congo=t61rcWkgMzE")
+
+	ctx := Extract(context.Background(), HeaderCarrier(header))
+	ctx, handle := minitrace.StartRootSpan(ctx, "root", minitrace.TraceID{}, 0, nil)
+	if traceID := handle.TraceID().String(); traceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("unmatched trace ID: got %s", traceID)
+	}
+
+	carrier := MapCarrier{}
+	Inject(ctx, carrier)
+	spanID, _, _ := minitrace.CurrentID(ctx)
+	if expected := formatTraceParent(handle.TraceID(), spanID, true); carrier["traceparent"] != expected {
+		t.Fatalf("unmatched traceparent: expected %s got %s", expected, carrier["traceparent"])
+	}
+	if carrier["tracestate"] != "congo=t61rcWkgMzE" {
+		t.Fatalf("unmatched tracestate: got %s", carrier["tracestate"])
+	}
+
+	trace, _ := handle.Collect()
+	if len(trace.Spans) != 1 || trace.Spans[0].ParentID != 0x00f067aa0ba902b7 {
+		t.Fatalf("expected the root span to be a child of the remote parent")
+	}
+}
+
+func TestPropagationUnsampled(t *testing.T) {
+	defer minitrace.SetSampler(nil)
+	minitrace.SetSampler(minitrace.ParentBasedSampler(minitrace.AlwaysSample()))
+
+	ctx := Extract(context.Background(), MapCarrier{
+		"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+	})
+	ctx, handle := minitrace.StartRootSpan(ctx, "root", minitrace.TraceID{}, 0, nil)
+	if handle.Sampled() {
+		t.Fatalf("expected to follow the unsampled remote parent")
+	}
+
+	carrier := MapCarrier{}
+	Inject(ctx, carrier)
+	if h := carrier["traceparent"]; len(h) != traceParentLen || h[3:35] != "4bf92f3577b34da6a3ce929d0e0e4736" || h[53:] != "00" {
+		t.Fatalf("expected an unsampled traceparent with the remote trace ID, got %s", h)
+	}
+}
+
+func TestParseTraceParent(t *testing.T) {
+	for _, h := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01extra",
+	} {
+		if _, ok := parseTraceParent(h); ok {
+			t.Fatalf("expected %q to be rejected", h)
+		}
+	}
+
+	remote, ok := parseTraceParent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-09-extra")
+	if !ok || !remote.Sampled || remote.SpanID != 0x00f067aa0ba902b7 {
+		t.Fatalf("expected a future version to be accepted, got %+v", remote)
+	}
+}
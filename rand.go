@@ -0,0 +1,42 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//go:build !go1.22
+// +build !go1.22
+
+package minitrace
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"math/rand"
+	"sync"
+)
+
+// The global source of `math/rand` is seeded with a constant before Go 1.20, so a private one
+// seeded from `crypto/rand` is used instead.
+var fastRand = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(cryptoSeed()))}
+
+func cryptoSeed() int64 {
+	var buf [8]byte
+	_, _ = crand.Read(buf[:])
+	return int64(binary.LittleEndian.Uint64(buf[:]))
+}
+
+func fastRandUint64() uint64 {
+	fastRand.Lock()
+	defer fastRand.Unlock()
+	return fastRand.Uint64()
+}
@@ -0,0 +1,45 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package minitrace
+
+import (
+	"context"
+)
+
+// RemoteSpanContext identifies a span living in another process, typically extracted from the
+// headers of an incoming request.
+type RemoteSpanContext struct {
+	TraceID TraceID
+	SpanID  uint64
+	Sampled bool
+
+	// Opaque vendor-specific data to be forwarded along with the IDs, e.g. W3C `tracestate`.
+	TraceState string
+}
+
+type remoteKey struct{}
+
+var remoteSpanKey = remoteKey{}
+
+// ContextWithRemoteSpanContext returns a copy of ctx carrying the remote parent. When `StartRootSpan`
+// is called on the returned context with zero `traceID` and `parentSpanID`, the root span joins
+// the remote trace and follows its sampling decision if the sampler is parent-based.
+func ContextWithRemoteSpanContext(ctx context.Context, remote RemoteSpanContext) context.Context {
+	return context.WithValue(ctx, remoteSpanKey, remote)
+}
+
+func RemoteSpanContextFromContext(ctx context.Context) (remote RemoteSpanContext, ok bool) {
+	remote, ok = ctx.Value(remoteSpanKey).(RemoteSpanContext)
+	return
+}
@@ -0,0 +1,262 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package reporter moves collected traces off the request path. Traces handed to a `BatchProcessor`
+// are queued and exported in batches by a background goroutine.
+package reporter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tikv/minitrace-go"
+)
+
+// Exporter sends a batch of traces to a backend. `Export` is never called concurrently by a
+// `BatchProcessor`.
+type Exporter interface {
+	Export(ctx context.Context, traces []minitrace.Trace) error
+}
+
+// ErrShutdown is returned by operations on a `BatchProcessor` that has been shut down.
+var ErrShutdown = errors.New("reporter: processor is shut down")
+
+const (
+	DefaultQueueSize     = 2048
+	DefaultMaxBatchSize  = 512
+	DefaultFlushInterval = time.Second
+	DefaultExportTimeout = 30 * time.Second
+)
+
+// Options configures a `BatchProcessor`. Zero fields take their defaults.
+type Options struct {
+	// Maximum number of traces waiting to be exported. Traces reported to a full queue are dropped.
+	QueueSize int
+	// Maximum number of traces passed to a single `Export` call.
+	MaxBatchSize int
+	// Maximum time a trace waits in the queue before being exported.
+	FlushInterval time.Duration
+	// Time limit of a single `Export` call.
+	ExportTimeout time.Duration
+	// Called with errors returned by the exporter, in the processor goroutine.
+	OnError func(err error)
+}
+
+type BatchProcessor struct {
+	// Accessed atomically, so kept first to be 64-bit aligned on 32-bit platforms.
+	dropped uint64
+
+	exporter Exporter
+	opts     Options
+
+	queue   chan minitrace.Trace
+	flushCh chan chan error
+	stopCh  chan struct{}
+	doneCh  chan struct{}
+
+	// Guards `stopped` so that no trace is queued after the final drain.
+	mu       sync.RWMutex
+	stopped  bool
+	stopOnce sync.Once
+	// Error of the final drain, set before `doneCh` is closed.
+	stopErr error
+}
+
+// NewBatchProcessor starts a processor goroutine exporting to `exporter`. The goroutine exits when
+// `Shutdown` is called.
+func NewBatchProcessor(exporter Exporter, opts Options) *BatchProcessor {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultQueueSize
+	}
+	if opts.MaxBatchSize <= 0 {
+		opts.MaxBatchSize = DefaultMaxBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultFlushInterval
+	}
+	if opts.ExportTimeout <= 0 {
+		opts.ExportTimeout = DefaultExportTimeout
+	}
+
+	p := &BatchProcessor{
+		exporter: exporter,
+		opts:     opts,
+		queue:    make(chan minitrace.Trace, opts.QueueSize),
+		flushCh:  make(chan chan error),
+		stopCh:   make(chan struct{}),
+		doneCh:   make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// Report enqueues the trace without blocking. It returns false if the trace is dropped because the
+// queue is full or the processor is shut down.
+func (p *BatchProcessor) Report(trace minitrace.Trace) bool {
+	if len(trace.Spans) == 0 {
+		return true
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.stopped {
+		atomic.AddUint64(&p.dropped, 1)
+		return false
+	}
+
+	select {
+	case p.queue <- trace:
+		return true
+	default:
+		atomic.AddUint64(&p.dropped, 1)
+		return false
+	}
+}
+
+// Dropped returns the number of traces dropped so far.
+func (p *BatchProcessor) Dropped() uint64 {
+	return atomic.LoadUint64(&p.dropped)
+}
+
+// Flush exports all traces reported before the call and waits for the export to finish.
+func (p *BatchProcessor) Flush(ctx context.Context) error {
+	errCh := make(chan error, 1)
+	select {
+	case p.flushCh <- errCh:
+	case <-p.doneCh:
+		return ErrShutdown
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown exports the remaining traces and stops the processor goroutine. It returns the error of
+// the final export, if any. Traces reported after Shutdown are dropped.
+func (p *BatchProcessor) Shutdown(ctx context.Context) error {
+	p.stopOnce.Do(func() {
+		p.mu.Lock()
+		p.stopped = true
+		p.mu.Unlock()
+		close(p.stopCh)
+	})
+
+	select {
+	case <-p.doneCh:
+		return p.stopErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *BatchProcessor) run() {
+	defer close(p.doneCh)
+
+	ticker := time.NewTicker(p.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]minitrace.Trace, 0, p.opts.MaxBatchSize)
+	export := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := p.export(batch)
+		// The exporter may retain the slice, so start over with a new one.
+		batch = make([]minitrace.Trace, 0, p.opts.MaxBatchSize)
+		return err
+	}
+	drain := func() error {
+		var firstErr error
+		for {
+			select {
+			case trace := <-p.queue:
+				batch = append(batch, trace)
+				if len(batch) < p.opts.MaxBatchSize {
+					continue
+				}
+				if err := export(); err != nil && firstErr == nil {
+					firstErr = err
+				}
+			default:
+				if err := export(); err != nil && firstErr == nil {
+					firstErr = err
+				}
+				return firstErr
+			}
+		}
+	}
+
+	for {
+		select {
+		case trace := <-p.queue:
+			batch = append(batch, trace)
+			if len(batch) >= p.opts.MaxBatchSize {
+				_ = export()
+			}
+		case <-ticker.C:
+			_ = export()
+		case errCh := <-p.flushCh:
+			errCh <- drain()
+		case <-p.stopCh:
+			p.stopErr = drain()
+			return
+		}
+	}
+}
+
+func (p *BatchProcessor) export(batch []minitrace.Trace) error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.opts.ExportTimeout)
+	defer cancel()
+
+	err := p.exporter.Export(ctx, batch)
+	if err != nil && p.opts.OnError != nil {
+		p.opts.OnError(err)
+	}
+	return err
+}
+
+var global atomic.Value
+
+type processorHolder struct {
+	processor *BatchProcessor
+}
+
+// SetGlobal installs the processor used by the package-level `Report`.
+func SetGlobal(p *BatchProcessor) {
+	global.Store(processorHolder{p})
+}
+
+// Global returns the processor installed by `SetGlobal`, or nil.
+func Global() *BatchProcessor {
+	holder, _ := global.Load().(processorHolder)
+	return holder.processor
+}
+
+// Report hands the trace to the global processor without blocking. It returns false if the trace
+// is dropped, including when no global processor is installed.
+func Report(trace minitrace.Trace) bool {
+	p := Global()
+	if p == nil {
+		return false
+	}
+	return p.Report(trace)
+}
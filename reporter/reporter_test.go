@@ -0,0 +1,232 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reporter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tikv/minitrace-go"
+)
+
+type recordingExporter struct {
+	mu      sync.Mutex
+	batches [][]minitrace.Trace
+	block   chan struct{}
+	err     error
+}
+
+func (e *recordingExporter) Export(ctx context.Context, traces []minitrace.Trace) error {
+	if e.block != nil {
+		<-e.block
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.batches = append(e.batches, traces)
+	return e.err
+}
+
+func (e *recordingExporter) count() (batches int, traces int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, batch := range e.batches {
+		traces += len(batch)
+	}
+	return len(e.batches), traces
+}
+
+func newTrace(i uint64) minitrace.Trace {
+	_, handle := minitrace.StartRootSpan(context.Background(), "root", minitrace.TraceID{Low: i}, 0, nil)
+	trace, _ := handle.Collect()
+	return trace
+}
+
+func TestBatchProcessor(t *testing.T) {
+	exporter := &recordingExporter{}
+	p := NewBatchProcessor(exporter, Options{MaxBatchSize: 4, FlushInterval: time.Hour})
+
+	for i := uint64(1); i <= 10; i++ {
+		if !p.Report(newTrace(i)) {
+			t.Fatalf("expected trace %d to be queued", i)
+		}
+	}
+	if err := p.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if batches, traces := exporter.count(); batches != 3 || traces != 10 {
+		t.Fatalf("expected 10 traces in 3 batches, got %d in %d", traces, batches)
+	}
+
+	p.Report(newTrace(11))
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, traces := exporter.count(); traces != 11 {
+		t.Fatalf("expected remaining traces to be exported on shutdown, got %d", traces)
+	}
+	if p.Report(newTrace(12)) || p.Dropped() != 1 {
+		t.Fatalf("expected traces reported after shutdown to be dropped")
+	}
+	if err := p.Flush(context.Background()); err != ErrShutdown {
+		t.Fatalf("expected %v, got %v", ErrShutdown, err)
+	}
+}
+
+func TestBatchProcessorDrop(t *testing.T) {
+	exporter := &recordingExporter{block: make(chan struct{})}
+	p := NewBatchProcessor(exporter, Options{QueueSize: 2, MaxBatchSize: 1, FlushInterval: time.Hour})
+
+	// The first trace is taken by the processor goroutine and blocks in `Export`.
+	p.Report(newTrace(1))
+	for i := 0; len(p.queue) != 0; i++ {
+		if i > 1000 {
+			t.Fatalf("processor goroutine did not pick up the trace")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	for i := uint64(2); i <= 5; i++ {
+		p.Report(newTrace(i))
+	}
+	if p.Dropped() != 2 {
+		t.Fatalf("expected %d dropped traces, got %d", 2, p.Dropped())
+	}
+
+	close(exporter.block)
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, traces := exporter.count(); traces != 3 {
+		t.Fatalf("expected %d exported traces, got %d", 3, traces)
+	}
+}
+
+func TestBatchProcessorShutdown(t *testing.T) {
+	exporter := &recordingExporter{err: errors.New("unavailable")}
+	p := NewBatchProcessor(exporter, Options{FlushInterval: time.Hour})
+
+	// Traces reported concurrently with Shutdown are either exported or counted as dropped.
+	var wg sync.WaitGroup
+	var queued uint64
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := uint64(0); j < 100; j++ {
+				if p.Report(newTrace(j + 1)) {
+					atomic.AddUint64(&queued, 1)
+				}
+			}
+		}()
+	}
+	time.Sleep(time.Millisecond)
+	if err := p.Shutdown(context.Background()); err != exporter.err {
+		t.Fatalf("expected the final export error %v, got %v", exporter.err, err)
+	}
+	wg.Wait()
+
+	if _, traces := exporter.count(); uint64(traces) != queued {
+		t.Fatalf("expected %d queued traces to be exported, got %d", queued, traces)
+	}
+	if queued+p.Dropped() != 400 {
+		t.Fatalf("expected %d traces exported or dropped, got %d", 400, queued+p.Dropped())
+	}
+}
+
+func TestGlobal(t *testing.T) {
+	if Report(newTrace(1)) {
+		t.Fatalf("expected to drop traces without a global processor")
+	}
+
+	exporter := &recordingExporter{}
+	p := NewBatchProcessor(exporter, Options{})
+	SetGlobal(p)
+	defer SetGlobal(nil)
+
+	if !Report(newTrace(1)) {
+		t.Fatalf("expected the trace to be queued")
+	}
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, traces := exporter.count(); traces != 1 {
+		t.Fatalf("expected %d exported traces, got %d", 1, traces)
+	}
+}
+
+type recordingReporter struct {
+	traces []minitrace.Trace
+}
+
+func (r *recordingReporter) Report(trace minitrace.Trace) bool {
+	r.traces = append(r.traces, trace)
+	return true
+}
+
+func TestTailSampler(t *testing.T) {
+	next := &recordingReporter{}
+	s := NewTailSampler(next, TailSamplingOptions{
+		LatencyThreshold: 100 * time.Millisecond,
+		KeepErrors:       true,
+		MatchProperty: func(property minitrace.Property) bool {
+			return property.Key == "debug" && property.Bool()
+		},
+		BaselineRatio: 0,
+	})
+
+	trace := func(low uint64, spans ...minitrace.Span) minitrace.Trace {
+		return minitrace.Trace{TraceID: minitrace.TraceID{Low: low}, Spans: spans}
+	}
+	fast := minitrace.Span{ID: 1, DurationNs: uint64(time.Millisecond)}
+	slow := minitrace.Span{ID: 1, ParentID: 99, DurationNs: uint64(time.Second)}
+	// Only the duration of the root counts, not that of its children.
+	slowChild := minitrace.Span{ID: 2, ParentID: 1, DurationNs: uint64(time.Second)}
+	failed := minitrace.Span{ID: 2, ParentID: 1, StatusCode: minitrace.StatusError}
+	debug := minitrace.Span{ID: 2, ParentID: 1, Properties: []minitrace.Property{minitrace.BoolProperty("debug", true)}}
+
+	cases := []struct {
+		trace minitrace.Trace
+		kept  bool
+	}{
+		{trace(1, fast), false},
+		{trace(2, slow), true},
+		{trace(3, slowChild, fast), false},
+		{trace(4, failed, fast), true},
+		{trace(5, debug, fast), true},
+		{trace(6, failed, slow), true},
+	}
+	for i, c := range cases {
+		if kept := s.Report(c.trace); kept != c.kept {
+			t.Fatalf("expected trace %d to be kept: %v", i, c.kept)
+		}
+	}
+	if len(next.traces) != 4 {
+		t.Fatalf("expected 4 traces to be passed on, got %d", len(next.traces))
+	}
+	if stats := s.Stats(); stats != (TailSamplingStats{Latency: 2, Error: 1, Property: 1, Dropped: 2}) {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	baseline := NewTailSampler(next, TailSamplingOptions{BaselineRatio: 0.5})
+	for i := uint64(0); i < 1000; i++ {
+		baseline.Report(trace(i, fast))
+	}
+	if stats := baseline.Stats(); stats.Baseline < 400 || stats.Baseline > 600 || stats.Baseline+stats.Dropped != 1000 {
+		t.Fatalf("unexpected baseline stats %+v", stats)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reporter
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/tikv/minitrace-go"
+)
+
+// Reporter accepts collected traces without blocking, such as `BatchProcessor` and `TailSampler`.
+type Reporter interface {
+	Report(trace minitrace.Trace) bool
+}
+
+// TailSamplingOptions configures the rules of a `TailSampler`. A trace is kept if any rule matches.
+type TailSamplingOptions struct {
+	// Keeps traces whose root span lasts at least this long. Zero disables the rule.
+	LatencyThreshold time.Duration
+	// Keeps traces containing a span with `minitrace.StatusError`.
+	KeepErrors bool
+	// Keeps traces containing a span with a property matched by this function. Nil disables the rule.
+	MatchProperty func(property minitrace.Property) bool
+	// Fraction of the other traces kept as a baseline. Traces are chosen by trace ID as by
+	// `minitrace.RatioSampler`, so the choice is consistent across processes.
+	BaselineRatio float64
+}
+
+// TailSamplingStats counts the traces kept by each rule, attributed to the first matching rule in
+// the order of `TailSamplingOptions`, and the traces dropped.
+type TailSamplingStats struct {
+	Latency  uint64
+	Error    uint64
+	Property uint64
+	Baseline uint64
+	Dropped  uint64
+}
+
+// TailSampler decides whether to keep a trace once it is complete, so that slow or failed requests
+// are kept regardless of head sampling. Kept traces are passed to the next reporter.
+type TailSampler struct {
+	next            Reporter
+	opts            TailSamplingOptions
+	baselineSampler minitrace.Sampler
+
+	latency  uint64
+	error    uint64
+	property uint64
+	baseline uint64
+	dropped  uint64
+}
+
+func NewTailSampler(next Reporter, opts TailSamplingOptions) *TailSampler {
+	return &TailSampler{
+		next:            next,
+		opts:            opts,
+		baselineSampler: minitrace.RatioSampler(opts.BaselineRatio),
+	}
+}
+
+// Report passes the trace to the next reporter if a rule matches. It returns false if the trace is
+// dropped, either by the rules or by the next reporter.
+func (s *TailSampler) Report(trace minitrace.Trace) bool {
+	if len(trace.Spans) == 0 {
+		return true
+	}
+
+	switch {
+	case s.opts.LatencyThreshold > 0 && rootDuration(trace) >= s.opts.LatencyThreshold:
+		atomic.AddUint64(&s.latency, 1)
+	case s.opts.KeepErrors && hasError(trace):
+		atomic.AddUint64(&s.error, 1)
+	case s.opts.MatchProperty != nil && s.hasProperty(trace):
+		atomic.AddUint64(&s.property, 1)
+	case s.baselineSampler.ShouldSample(minitrace.SamplingParameters{TraceID: trace.TraceID}):
+		atomic.AddUint64(&s.baseline, 1)
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+		return false
+	}
+	return s.next.Report(trace)
+}
+
+func (s *TailSampler) Stats() TailSamplingStats {
+	return TailSamplingStats{
+		Latency:  atomic.LoadUint64(&s.latency),
+		Error:    atomic.LoadUint64(&s.error),
+		Property: atomic.LoadUint64(&s.property),
+		Baseline: atomic.LoadUint64(&s.baseline),
+		Dropped:  atomic.LoadUint64(&s.dropped),
+	}
+}
+
+// Returns the duration of the longest span whose parent is not in the trace. Such spans are the
+// root, or the children of a remote parent for traces joined across processes.
+func rootDuration(trace minitrace.Trace) time.Duration {
+	ids := make(map[uint64]struct{}, len(trace.Spans))
+	for i := range trace.Spans {
+		ids[trace.Spans[i].ID] = struct{}{}
+	}
+
+	var duration uint64
+	for i := range trace.Spans {
+		span := &trace.Spans[i]
+		if _, ok := ids[span.ParentID]; !ok && span.DurationNs > duration {
+			duration = span.DurationNs
+		}
+	}
+	return time.Duration(duration)
+}
+
+func hasError(trace minitrace.Trace) bool {
+	for i := range trace.Spans {
+		if trace.Spans[i].StatusCode == minitrace.StatusError {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *TailSampler) hasProperty(trace minitrace.Trace) bool {
+	for i := range trace.Spans {
+		for _, property := range trace.Spans[i].Properties {
+			if s.opts.MatchProperty(property) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package minitrace
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// Sampler decides whether a trace started by `StartRootSpan` should be recorded.
+type Sampler interface {
+	ShouldSample(params SamplingParameters) bool
+}
+
+type SamplingParameters struct {
+	Context      context.Context
+	Event        string
+	TraceID      TraceID
+	ParentSpanID uint64
+
+	// Whether the sampling decision of a parent is known, e.g. `ctx` already carries an active trace.
+	HasParent     bool
+	ParentSampled bool
+}
+
+type samplerHolder struct {
+	sampler Sampler
+}
+
+var globalSampler atomic.Value
+
+// SetSampler replaces the sampler consulted by `StartRootSpan`. A nil sampler records every trace,
+// which is the default.
+func SetSampler(sampler Sampler) {
+	globalSampler.Store(samplerHolder{sampler})
+}
+
+func shouldSample(params SamplingParameters) bool {
+	holder, ok := globalSampler.Load().(samplerHolder)
+	if !ok || holder.sampler == nil {
+		return true
+	}
+	return holder.sampler.ShouldSample(params)
+}
+
+type constSampler bool
+
+func (s constSampler) ShouldSample(SamplingParameters) bool {
+	return bool(s)
+}
+
+// AlwaysSample returns a sampler recording every trace.
+func AlwaysSample() Sampler {
+	return constSampler(true)
+}
+
+// NeverSample returns a sampler dropping every trace.
+func NeverSample() Sampler {
+	return constSampler(false)
+}
+
+type ratioSampler struct {
+	threshold uint64
+}
+
+// RatioSampler returns a sampler recording the given fraction of traces. The decision is derived from
+// the trace ID, so every process sharing a trace ID makes the same decision.
+func RatioSampler(ratio float64) Sampler {
+	if ratio >= 1 {
+		return AlwaysSample()
+	}
+	if ratio <= 0 {
+		return NeverSample()
+	}
+	return ratioSampler{threshold: uint64(ratio*(1<<63)) << 1}
+}
+
+func (s ratioSampler) ShouldSample(params SamplingParameters) bool {
+	return mix64(params.TraceID.Low) < s.threshold
+}
+
+// Scatters sequential trace IDs over the whole uint64 range (the splitmix64 finalizer).
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+type rateLimitingSampler struct {
+	now func() uint64 // Monotonic time in nanoseconds, replaced in tests
+
+	mu             sync.Mutex
+	perSecond      float64
+	balance        float64
+	lastMonoTimeNs uint64
+}
+
+// RateLimitingSampler returns a sampler recording at most `perSecond` traces per second, allowing a
+// burst of up to one second worth of traces.
+func RateLimitingSampler(perSecond float64) Sampler {
+	if perSecond <= 0 {
+		return NeverSample()
+	}
+	return &rateLimitingSampler{
+		now:            monotimeNs,
+		perSecond:      perSecond,
+		balance:        perSecond,
+		lastMonoTimeNs: monotimeNs(),
+	}
+}
+
+func (s *rateLimitingSampler) ShouldSample(SamplingParameters) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The clock is read under the lock so that it does not go back between calls, which would
+	// underflow the elapsed time and refill the whole budget. A clock behind anyway refills nothing.
+	if now := s.now(); now > s.lastMonoTimeNs {
+		s.balance += float64(now-s.lastMonoTimeNs) / 1e9 * s.perSecond
+		if s.balance > s.perSecond {
+			s.balance = s.perSecond
+		}
+		s.lastMonoTimeNs = now
+	}
+
+	if s.balance < 1 {
+		return false
+	}
+	s.balance--
+	return true
+}
+
+type parentBasedSampler struct {
+	root Sampler
+}
+
+// ParentBasedSampler returns a sampler following the decision of the parent if it is known, and
+// consulting `root` otherwise.
+func ParentBasedSampler(root Sampler) Sampler {
+	return parentBasedSampler{root: root}
+}
+
+func (s parentBasedSampler) ShouldSample(params SamplingParameters) bool {
+	if params.HasParent {
+		return params.ParentSampled
+	}
+	return s.root.ShouldSample(params)
+}
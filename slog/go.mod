@@ -0,0 +1,5 @@
+module github.com/tikv/minitrace-go/slog
+
+go 1.25.0
+
+require github.com/tikv/minitrace-go v0.0.0-20261017135809-0305372f147c
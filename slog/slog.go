@@ -0,0 +1,145 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package slog correlates `log/slog` records with minitrace spans.
+package slog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/tikv/minitrace-go"
+)
+
+const (
+	DefaultTraceIDKey = "trace_id"
+	DefaultSpanIDKey  = "span_id"
+)
+
+// Options configures a handler. Zero fields take their defaults.
+type Options struct {
+	// Keys of the attributes holding the IDs of the span active in the record context, formatted as
+	// in W3C Trace Context. Default to `DefaultTraceIDKey` and `DefaultSpanIDKey`.
+	TraceIDKey string
+	SpanIDKey  string
+	// Records at or above this level are also added as events to the active span, named by the
+	// message and with the attributes as properties. Nil disables it.
+	EventLevel slog.Leveler
+}
+
+// Handler adds the IDs of the active span to records before passing them to the next handler. The
+// attributes belong to the current group, if any, as all attributes added by handlers do.
+type Handler struct {
+	next slog.Handler
+	opts Options
+
+	// Attributes and group of `WithAttrs` and `WithGroup`, flattened for span events.
+	attrs  []minitrace.Property
+	prefix string
+}
+
+var _ slog.Handler = (*Handler)(nil)
+
+func NewHandler(next slog.Handler, opts Options) *Handler {
+	if opts.TraceIDKey == "" {
+		opts.TraceIDKey = DefaultTraceIDKey
+	}
+	if opts.SpanIDKey == "" {
+		opts.SpanIDKey = DefaultSpanIDKey
+	}
+	return &Handler{next: next, opts: opts}
+}
+
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	spanID, traceID, ok := minitrace.CurrentID(ctx)
+	if !ok {
+		return h.next.Handle(ctx, r)
+	}
+
+	if h.opts.EventLevel != nil && r.Level >= h.opts.EventLevel.Level() {
+		properties := make([]minitrace.Property, 0, 1+len(h.attrs)+r.NumAttrs())
+		properties = append(properties, minitrace.StringProperty("level", r.Level.String()))
+		properties = append(properties, h.attrs...)
+		r.Attrs(func(a slog.Attr) bool {
+			properties = appendAttr(properties, h.prefix, a)
+			return true
+		})
+		minitrace.AddEvent(ctx, r.Message, properties...)
+	}
+
+	// Records must not be modified in place, as they may be shared with other handlers.
+	r = r.Clone()
+	r.AddAttrs(
+		slog.String(h.opts.TraceIDKey, traceID.String()),
+		slog.String(h.opts.SpanIDKey, fmt.Sprintf("%016x", spanID)),
+	)
+	return h.next.Handle(ctx, r)
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.next = h.next.WithAttrs(attrs)
+	h2.attrs = append([]minitrace.Property(nil), h.attrs...)
+	for _, a := range attrs {
+		h2.attrs = appendAttr(h2.attrs, h.prefix, a)
+	}
+	return &h2
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.next = h.next.WithGroup(name)
+	h2.prefix = h.prefix + name + "."
+	return &h2
+}
+
+// Appends an attribute as properties, flattening groups into dotted keys.
+func appendAttr(properties []minitrace.Property, prefix string, a slog.Attr) []minitrace.Property {
+	v := a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return properties
+	}
+
+	key := prefix + a.Key
+	switch v.Kind() {
+	case slog.KindGroup:
+		// Attributes of groups without a key are inlined, as in `slog.Handler`.
+		if a.Key != "" {
+			prefix = key + "."
+		}
+		for _, ga := range v.Group() {
+			properties = appendAttr(properties, prefix, ga)
+		}
+		return properties
+	case slog.KindInt64:
+		return append(properties, minitrace.IntProperty(key, v.Int64()))
+	case slog.KindUint64:
+		return append(properties, minitrace.IntProperty(key, int64(v.Uint64())))
+	case slog.KindFloat64:
+		return append(properties, minitrace.FloatProperty(key, v.Float64()))
+	case slog.KindBool:
+		return append(properties, minitrace.BoolProperty(key, v.Bool()))
+	case slog.KindDuration:
+		return append(properties, minitrace.DurationProperty(key, v.Duration()))
+	default:
+		return append(properties, minitrace.StringProperty(key, v.String()))
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tikv/minitrace-go"
+)
+
+func TestHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(slog.NewJSONHandler(&buf, nil), Options{EventLevel: slog.LevelWarn}))
+	logger = logger.With("region", 42).WithGroup("req")
+
+	ctx, root := minitrace.StartRootSpan(context.Background(), "root", minitrace.TraceID{High: 1, Low: 2}, 0, nil)
+	ctx, child := minitrace.StartSpanWithContext(ctx, "child")
+	spanID, _, _ := minitrace.CurrentID(ctx)
+	logger.InfoContext(ctx, "started")
+	logger.WarnContext(ctx, "slow", "elapsed", time.Second, slog.Group("peer", "addr", "tikv-1"))
+	child.Finish()
+	logger.Info("untraced")
+	trace, _ := root.Collect()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %q", buf.String())
+	}
+	for i, line := range lines {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		group, _ := record["req"].(map[string]interface{})
+		if i == 2 {
+			if group != nil {
+				t.Fatalf("expected no IDs without a span, got %s", line)
+			}
+			continue
+		}
+		if group["trace_id"] != "00000000000000010000000000000002" || group["span_id"] != fmt.Sprintf("%016x", spanID) {
+			t.Fatalf("unexpected IDs in %s", line)
+		}
+	}
+
+	if len(trace.Spans) != 2 {
+		t.Fatalf("expected 2 spans, got %v", trace.Spans)
+	}
+	events := trace.Spans[0].Events
+	if len(events) != 1 || events[0].Name != "slow" {
+		t.Fatalf("expected only the warning as an event, got %v", events)
+	}
+	properties := map[string]minitrace.Property{}
+	for _, p := range events[0].Properties {
+		properties[p.Key] = p
+	}
+	if properties["level"].Value != "WARN" || properties["region"].Int() != 42 ||
+		properties["req.elapsed"].Duration() != time.Second || properties["req.peer.addr"].Value != "tikv-1" {
+		t.Fatalf("unexpected event properties %v", events[0].Properties)
+	}
+}
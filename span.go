@@ -13,21 +13,63 @@
 
 package minitrace
 
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+)
+
 type Span struct {
 	ID              uint64
 	ParentID        uint64 // 0 means Root
+	RefType         RefType
 	BeginUnixTimeNs uint64
 	DurationNs      uint64
 	Event           string
 	Properties      []Property
+	Events          []Event
+
+	StatusCode    StatusCode
+	StatusMessage string
+	ErrorType     string // Go type of the error recorded by `SetError`, e.g. "*net.OpError"
+}
+
+// RefType describes how a span relates to its parent.
+type RefType uint8
+
+const (
+	// The parent depends on the result of the span, e.g. a synchronous call.
+	ChildOf RefType = iota
+	// The parent does not wait for the span, e.g. asynchronous work spawned by the parent.
+	FollowsFrom
+)
+
+type StatusCode uint8
+
+const (
+	StatusUnset StatusCode = iota
+	StatusOK
+	StatusError
+)
+
+func (c StatusCode) String() string {
+	switch c {
+	case StatusOK:
+		return "OK"
+	case StatusError:
+		return "ERROR"
+	default:
+		return "UNSET"
+	}
 }
 
-func (s *Span) beginWith(parentID uint64, event string) {
+func (s *Span) beginWith(ctx *traceContext, parentID uint64, event string) {
 	s.ID = nextID()
 	s.ParentID = parentID
 
 	// Fill a monotonic time for now. After span is finished, it will replace by a unix time.
-	s.BeginUnixTimeNs = monotimeNs()
+	s.BeginUnixTimeNs = ctx.monotimeNs()
 
 	s.Event = event
 }
@@ -35,15 +77,122 @@ func (s *Span) beginWith(parentID uint64, event string) {
 func (s *Span) endWith(ctx *traceContext) {
 	// For now, `beginUnixTimeNs` is a monotonic time. Here to correct its value to satisfy the semantic.
 	beginMonoTimeNs := s.BeginUnixTimeNs
-	s.DurationNs = monotimeNs() - beginMonoTimeNs
-	s.BeginUnixTimeNs = (beginMonoTimeNs - ctx.createMonoTimeNs) + ctx.createUnixTimeNs
+	s.DurationNs = ctx.monotimeNs() - beginMonoTimeNs
+	s.BeginUnixTimeNs = ctx.unixTimeNs(beginMonoTimeNs)
+
+	// Same correction for events, whose timestamps are monotonic until now.
+	for i := range s.Events {
+		s.Events[i].UnixTimeNs = ctx.unixTimeNs(s.Events[i].UnixTimeNs)
+	}
+}
+
+func (s *Span) addEvent(ctx *traceContext, name string, properties []Property) {
+	s.Events = append(s.Events, Event{
+		Name: name,
+		// Fill a monotonic time for now. After span is finished, it will replace by a unix time.
+		UnixTimeNs: ctx.monotimeNs(),
+		Properties: properties,
+	})
+}
+
+func (s *Span) addProperty(property Property) {
+	s.Properties = append(s.Properties, property)
+}
+
+func (s *Span) setStatus(code StatusCode, message string) {
+	s.StatusCode = code
+	s.StatusMessage = message
+	if code != StatusError {
+		// A span which recovered from an error must not be exported with its type.
+		s.ErrorType = ""
+	}
 }
 
-func (s *Span) addProperty(key, value string) {
-	s.Properties = append(s.Properties, Property{Key: key, Value: value})
+func (s *Span) setError(err error) {
+	s.setStatus(StatusError, err.Error())
+	s.ErrorType = reflect.TypeOf(err).String()
 }
 
+// Property is a key-value pair. String values are held in `Value`, while other types are packed into
+// `Num` to avoid allocation; use the typed accessors to read them.
 type Property struct {
 	Key   string
 	Value string
+	Type  PropertyType
+	Num   uint64
+}
+
+type PropertyType uint8
+
+const (
+	PropertyString PropertyType = iota
+	PropertyInt
+	PropertyBool
+	PropertyFloat
+	// A `time.Duration`, exported as an integer number of nanoseconds.
+	PropertyDuration
+)
+
+func StringProperty(key, value string) Property {
+	return Property{Key: key, Value: value}
+}
+
+func IntProperty(key string, value int64) Property {
+	return Property{Key: key, Type: PropertyInt, Num: uint64(value)}
+}
+
+func BoolProperty(key string, value bool) Property {
+	var num uint64
+	if value {
+		num = 1
+	}
+	return Property{Key: key, Type: PropertyBool, Num: num}
+}
+
+func FloatProperty(key string, value float64) Property {
+	return Property{Key: key, Type: PropertyFloat, Num: math.Float64bits(value)}
+}
+
+func DurationProperty(key string, value time.Duration) Property {
+	return Property{Key: key, Type: PropertyDuration, Num: uint64(value)}
+}
+
+// Int returns the value of an int or duration property.
+func (p Property) Int() int64 {
+	return int64(p.Num)
+}
+
+func (p Property) Bool() bool {
+	return p.Num != 0
+}
+
+func (p Property) Float() float64 {
+	return math.Float64frombits(p.Num)
+}
+
+func (p Property) Duration() time.Duration {
+	return time.Duration(p.Num)
+}
+
+// ValueString formats the value as a string regardless of its type.
+func (p Property) ValueString() string {
+	switch p.Type {
+	case PropertyInt:
+		return strconv.FormatInt(p.Int(), 10)
+	case PropertyBool:
+		return strconv.FormatBool(p.Bool())
+	case PropertyFloat:
+		return strconv.FormatFloat(p.Float(), 'g', -1, 64)
+	case PropertyDuration:
+		return p.Duration().String()
+	default:
+		return p.Value
+	}
+}
+
+// Event is something that happened at a point in time within a span.
+type Event struct {
+	Name       string
+	UnixTimeNs uint64
+	Properties []Property
 }
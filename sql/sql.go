@@ -0,0 +1,423 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sql wraps `database/sql` drivers to trace statements by children of the span active in
+// the context passed to `database/sql`. Calls without an active span are not traced.
+//
+//	db := sql.OpenDB(mtsql.WrapConnector(connector, mtsql.Options{Sanitize: mtsql.SanitizeLiterals}))
+package sql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+
+	"github.com/tikv/minitrace-go"
+)
+
+// Options configures the wrapped driver. Zero fields take their defaults.
+type Options struct {
+	// Rewrites statements before they are recorded, e.g. to strip sensitive literals, see
+	// `SanitizeLiterals`. An empty result omits the statement. Defaults to recording statements as is.
+	Sanitize func(query string) string
+}
+
+func (opts *Options) statement(query string) string {
+	if opts.Sanitize != nil {
+		return opts.Sanitize(query)
+	}
+	return query
+}
+
+// Starts a span for a call. Spans of calls returning `driver.ErrSkip` are discarded by `finish`, as
+// `database/sql` retries them by other means, which are traced again. Statements are only sanitized
+// for recorded spans.
+func (opts *Options) startSpan(ctx context.Context, event string, query string) minitrace.SpanHandle {
+	span := minitrace.StartSpan(ctx, event)
+	if !minitrace.IsSampled(ctx) {
+		return span
+	}
+	if stmt := opts.statement(query); stmt != "" {
+		span.AddProperty("db.statement", stmt)
+	}
+	return span
+}
+
+func finish(span *minitrace.SpanHandle, err error) {
+	if err == driver.ErrSkip {
+		span.Discard()
+		return
+	}
+	if err != nil {
+		span.SetError(err)
+	}
+	span.Finish()
+}
+
+func finishResult(span *minitrace.SpanHandle, result driver.Result, err error) {
+	if err == nil {
+		if rows, err := result.RowsAffected(); err == nil {
+			span.AddPropertyInt("db.rows_affected", rows)
+		}
+	}
+	finish(span, err)
+}
+
+// Wrap returns a driver tracing the connections opened by `d`.
+func Wrap(d driver.Driver, opts Options) driver.Driver {
+	return &wrappedDriver{driver: d, opts: opts}
+}
+
+// WrapConnector returns a connector tracing the connections opened by `c`, to be passed to
+// `sql.OpenDB`.
+func WrapConnector(c driver.Connector, opts Options) driver.Connector {
+	return &connector{connector: c, driver: &wrappedDriver{driver: c.Driver(), opts: opts}}
+}
+
+type wrappedDriver struct {
+	driver driver.Driver
+	opts   Options
+}
+
+func (d *wrappedDriver) Open(name string) (driver.Conn, error) {
+	c, err := d.driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{conn: c, opts: &d.opts}, nil
+}
+
+func (d *wrappedDriver) OpenConnector(name string) (driver.Connector, error) {
+	if dc, ok := d.driver.(driver.DriverContext); ok {
+		c, err := dc.OpenConnector(name)
+		if err != nil {
+			return nil, err
+		}
+		return &connector{connector: c, driver: d}, nil
+	}
+	return &connector{connector: dsnConnector{name: name, driver: d.driver}, driver: d}, nil
+}
+
+type connector struct {
+	connector driver.Connector
+	driver    *wrappedDriver
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn0, err := c.connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{conn: conn0, opts: &c.driver.opts}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// Opens connections of drivers without `driver.DriverContext`, as `database/sql` does.
+type dsnConnector struct {
+	name   string
+	driver driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.name)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+type conn struct {
+	conn driver.Conn
+	opts *Options
+}
+
+var (
+	_ driver.ConnPrepareContext = (*conn)(nil)
+	_ driver.ConnBeginTx        = (*conn)(nil)
+	_ driver.QueryerContext     = (*conn)(nil)
+	_ driver.ExecerContext      = (*conn)(nil)
+	_ driver.Pinger             = (*conn)(nil)
+	_ driver.SessionResetter    = (*conn)(nil)
+	_ validator                 = (*conn)(nil)
+	_ driver.NamedValueChecker  = (*conn)(nil)
+)
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	span := c.opts.startSpan(ctx, "sql.Prepare", query)
+	var s driver.Stmt
+	var err error
+	if cp, ok := c.conn.(driver.ConnPrepareContext); ok {
+		s, err = cp.PrepareContext(ctx, query)
+	} else {
+		s, err = c.conn.Prepare(query)
+	}
+	finish(&span, err)
+	if err != nil {
+		return nil, err
+	}
+	return wrapStmt(&stmt{stmt: s, query: query, opts: c.opts}), nil
+}
+
+func (c *conn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	span := minitrace.StartSpan(ctx, "sql.Begin")
+	var t driver.Tx
+	var err error
+	if cb, ok := c.conn.(driver.ConnBeginTx); ok {
+		t, err = cb.BeginTx(ctx, opts)
+	} else if opts.Isolation != driver.IsolationLevel(0) || opts.ReadOnly {
+		err = errors.New("sql: driver does not support non-default transaction options")
+	} else {
+		t, err = c.conn.Begin()
+	}
+	finish(&span, err)
+	if err != nil {
+		return nil, err
+	}
+	// `driver.Tx` has no context, so the commit is traced in the context of the transaction.
+	return &tx{tx: t, ctx: ctx}, nil
+}
+
+// QueryContext traces queries until the rows are returned, excluding the time to read them.
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	qc, ok := c.conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	span := c.opts.startSpan(ctx, "sql.Query", query)
+	rows, err := qc.QueryContext(ctx, query, args)
+	finish(&span, err)
+	return rows, err
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	ec, ok := c.conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	span := c.opts.startSpan(ctx, "sql.Exec", query)
+	result, err := ec.ExecContext(ctx, query, args)
+	finishResult(&span, result, err)
+	return result, err
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	if p, ok := c.conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *conn) ResetSession(ctx context.Context) error {
+	if r, ok := c.conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+// Mirrors `driver.Validator`, which was added in Go 1.15.
+type validator interface {
+	IsValid() bool
+}
+
+func (c *conn) IsValid() bool {
+	if v, ok := c.conn.(validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if nc, ok := c.conn.(driver.NamedValueChecker); ok {
+		return nc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+type tx struct {
+	tx  driver.Tx
+	ctx context.Context
+}
+
+func (t *tx) Commit() error {
+	span := minitrace.StartSpan(t.ctx, "sql.Commit")
+	err := t.tx.Commit()
+	finish(&span, err)
+	return err
+}
+
+func (t *tx) Rollback() error {
+	span := minitrace.StartSpan(t.ctx, "sql.Rollback")
+	err := t.tx.Rollback()
+	finish(&span, err)
+	return err
+}
+
+type stmt struct {
+	stmt  driver.Stmt
+	query string
+	opts  *Options
+}
+
+var (
+	_ driver.StmtQueryContext  = (*stmt)(nil)
+	_ driver.StmtExecContext   = (*stmt)(nil)
+	_ driver.NamedValueChecker = (*stmt)(nil)
+)
+
+// Exposes `driver.ColumnConverter` only if the wrapped statement implements it, as `database/sql`
+// converts arguments differently for statements which do.
+func wrapStmt(s *stmt) driver.Stmt {
+	if cc, ok := s.stmt.(driver.ColumnConverter); ok {
+		return &columnConverterStmt{stmt: s, converter: cc}
+	}
+	return s
+}
+
+type columnConverterStmt struct {
+	*stmt
+	converter driver.ColumnConverter
+}
+
+func (s *columnConverterStmt) ColumnConverter(idx int) driver.ValueConverter {
+	return s.converter.ColumnConverter(idx)
+}
+
+func (s *stmt) Close() error {
+	return s.stmt.Close()
+}
+
+func (s *stmt) NumInput() int {
+	return s.stmt.NumInput()
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.stmt.Exec(args)
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.stmt.Query(args)
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	span := s.opts.startSpan(ctx, "sql.Exec", s.query)
+	var result driver.Result
+	var err error
+	if se, ok := s.stmt.(driver.StmtExecContext); ok {
+		result, err = se.ExecContext(ctx, args)
+	} else if values, verr := namedValuesToValues(args); verr != nil {
+		err = verr
+	} else {
+		result, err = s.stmt.Exec(values)
+	}
+	finishResult(&span, result, err)
+	return result, err
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	span := s.opts.startSpan(ctx, "sql.Query", s.query)
+	var rows driver.Rows
+	var err error
+	if sq, ok := s.stmt.(driver.StmtQueryContext); ok {
+		rows, err = sq.QueryContext(ctx, args)
+	} else if values, verr := namedValuesToValues(args); verr != nil {
+		err = verr
+	} else {
+		rows, err = s.stmt.Query(values)
+	}
+	finish(&span, err)
+	return rows, err
+}
+
+func (s *stmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if nc, ok := s.stmt.(driver.NamedValueChecker); ok {
+		return nc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func namedValuesToValues(named []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(named))
+	for i, nv := range named {
+		if nv.Name != "" {
+			return nil, errors.New("sql: driver does not support the use of named parameters")
+		}
+		values[i] = nv.Value
+	}
+	return values, nil
+}
+
+// SanitizeLiterals replaces string literals and numeric literals of a statement by "?", so that
+// values do not leak into traces. String literals are quoted by single quotes, or by double quotes
+// as in MySQL, and a quote within them is escaped by doubling it, as in standard SQL. Backslash
+// escapes are not recognized, so with MySQL they hide the end of a literal unless the
+// NO_BACKSLASH_ESCAPES mode is set. Identifiers quoted by double quotes, as in standard SQL, are
+// replaced as well.
+func SanitizeLiterals(query string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"':
+			// Skip to the closing quote, where a doubled quote escapes itself.
+			j := i + 1
+			for j < len(query) {
+				if query[j] == c {
+					if j+1 < len(query) && query[j+1] == c {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			b.WriteByte('?')
+			i = j + 1
+		case isDigit(c) && (i == 0 || !isIdentifier(query[i-1])):
+			j := i
+			for j < len(query) && (isIdentifier(query[j]) || query[j] == '.') {
+				j++
+			}
+			b.WriteByte('?')
+			i = j
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentifier(c byte) bool {
+	return isDigit(c) || c == '_' || c == '$' || (c|0x20 >= 'a' && c|0x20 <= 'z')
+}
@@ -0,0 +1,243 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/tikv/minitrace-go"
+)
+
+// A fake driver which, like many drivers, only executes statements without arguments directly.
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	return fakeConn{}, nil
+}
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) {
+	if query == "INVALID" {
+		return nil, errors.New("syntax error")
+	}
+	return fakeStmt{}, nil
+}
+
+func (fakeConn) Close() error {
+	return nil
+}
+
+func (fakeConn) Begin() (driver.Tx, error) {
+	return fakeTx{}, nil
+}
+
+func (fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if len(args) > 0 {
+		return nil, driver.ErrSkip
+	}
+	return driver.RowsAffected(3), nil
+}
+
+func (fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if len(args) > 0 {
+		return nil, driver.ErrSkip
+	}
+	return &fakeRows{}, nil
+}
+
+type fakeStmt struct{}
+
+func (fakeStmt) Close() error {
+	return nil
+}
+
+func (fakeStmt) NumInput() int {
+	return -1
+}
+
+func (fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(int64(len(args))), nil
+}
+
+func (fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &fakeRows{}, nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error {
+	return nil
+}
+
+func (fakeTx) Rollback() error {
+	return nil
+}
+
+type fakeRows struct {
+	done bool
+}
+
+func (*fakeRows) Columns() []string {
+	return []string{"n"}
+}
+
+func (*fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
+
+func TestDriver(t *testing.T) {
+	sql.Register("minitrace-fake", Wrap(fakeDriver{}, Options{Sanitize: SanitizeLiterals}))
+	db, err := sql.Open("minitrace-fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx, root := minitrace.StartRootSpan(context.Background(), "root", minitrace.TraceID{Low: 1}, 0, nil)
+	if _, err := db.ExecContext(ctx, "DELETE FROM t WHERE name = 'alice'"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ExecContext(ctx, "UPDATE t SET a = ? WHERE b = 10", 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := db.QueryRowContext(ctx, "SELECT n FROM t").Scan(&n); err != nil || n != 1 {
+		t.Fatalf("unexpected query result %d %v", n, err)
+	}
+	if _, err := db.PrepareContext(ctx, "INVALID"); err == nil {
+		t.Fatalf("expected a prepare error")
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	// Calls without an active span are not traced.
+	if _, err := db.ExecContext(context.Background(), "DELETE FROM t"); err != nil {
+		t.Fatal(err)
+	}
+	trace, _ := root.Collect()
+
+	type expected struct {
+		event        string
+		statement    string
+		rowsAffected int64
+		failed       bool
+	}
+	expectedSpans := []expected{
+		{event: "sql.Exec", statement: "DELETE FROM t WHERE name = ?", rowsAffected: 3},
+		// Executing with arguments is skipped by the driver, so the statement is prepared first.
+		{event: "sql.Prepare", statement: "UPDATE t SET a = ? WHERE b = ?"},
+		{event: "sql.Exec", statement: "UPDATE t SET a = ? WHERE b = ?", rowsAffected: 2},
+		{event: "sql.Query", statement: "SELECT n FROM t"},
+		{event: "sql.Prepare", statement: "INVALID", failed: true},
+		{event: "sql.Begin"},
+		{event: "sql.Commit"},
+		{event: "root"},
+	}
+	if len(trace.Spans) != len(expectedSpans) {
+		t.Fatalf("expected %d spans, got %v", len(expectedSpans), trace.Spans)
+	}
+	for i, e := range expectedSpans {
+		span := trace.Spans[i]
+		properties := map[string]minitrace.Property{}
+		for _, p := range span.Properties {
+			properties[p.Key] = p
+		}
+		if span.Event != e.event || properties["db.statement"].Value != e.statement {
+			t.Fatalf("expected span %d to be %s %q, got %s %v", i, e.event, e.statement, span.Event, span.Properties)
+		}
+		if properties["db.rows_affected"].Int() != e.rowsAffected {
+			t.Fatalf("unexpected rows affected of span %d: %v", i, span.Properties)
+		}
+		if (span.StatusCode == minitrace.StatusError) != e.failed {
+			t.Fatalf("unexpected status of span %d: %s", i, span.StatusCode)
+		}
+	}
+}
+
+type converterStmt struct {
+	fakeStmt
+}
+
+func (converterStmt) ColumnConverter(idx int) driver.ValueConverter {
+	return driver.DefaultParameterConverter
+}
+
+func TestDriverUnsampled(t *testing.T) {
+	sanitized := 0
+	sql.Register("minitrace-fake-unsampled", Wrap(fakeDriver{}, Options{Sanitize: func(query string) string {
+		sanitized++
+		return query
+	}}))
+	db, err := sql.Open("minitrace-fake-unsampled", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	minitrace.SetSampler(minitrace.NeverSample())
+	defer minitrace.SetSampler(nil)
+	ctx, _ := minitrace.StartRootSpan(context.Background(), "root", minitrace.TraceID{Low: 1}, 0, nil)
+	for _, ctx := range []context.Context{context.Background(), ctx} {
+		if _, err := db.ExecContext(ctx, "DELETE FROM t WHERE name = 'alice'"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sanitized != 0 {
+		t.Fatalf("expected statements of unrecorded spans not to be sanitized, got %d", sanitized)
+	}
+}
+
+func TestColumnConverter(t *testing.T) {
+	if _, ok := wrapStmt(&stmt{stmt: converterStmt{}}).(driver.ColumnConverter); !ok {
+		t.Fatalf("expected driver.ColumnConverter to be forwarded")
+	}
+	if _, ok := wrapStmt(&stmt{stmt: fakeStmt{}}).(driver.ColumnConverter); ok {
+		t.Fatalf("expected no driver.ColumnConverter when the statement has none")
+	}
+}
+
+func TestSanitizeLiterals(t *testing.T) {
+	for query, expected := range map[string]string{
+		"SELECT * FROM t1 WHERE a = 'x''y' AND b IN (1, 2.5) LIMIT 10": "SELECT * FROM t1 WHERE a = ? AND b IN (?, ?) LIMIT ?",
+		"INSERT INTO t VALUES ('it''s', -3, 0x1F)":                     "INSERT INTO t VALUES (?, -?, ?)",
+		"SELECT a1, `b2` FROM t$3 WHERE c = ?":                         "SELECT a1, `b2` FROM t$3 WHERE c = ?",
+		// A backslash does not escape the quote.
+		`SELECT * FROM t WHERE path = 'C:\' AND token = 'secret'`: "SELECT * FROM t WHERE path = ? AND token = ?",
+		// MySQL reads double-quoted strings as literals.
+		`SELECT * FROM t WHERE name = "bob" AND note = "say ""hi"""`: "SELECT * FROM t WHERE name = ? AND note = ?",
+	} {
+		if actual := SanitizeLiterals(query); actual != expected {
+			t.Fatalf("expected %q, got %q", expected, actual)
+		}
+	}
+}
@@ -15,29 +15,112 @@ package minitrace
 
 import (
 	"context"
-	"math/rand"
+	"encoding/hex"
+	rtrace "runtime/trace"
+	"time"
 )
 
 type Trace struct {
-	TraceID uint64
+	TraceID TraceID
 	Spans   []Span
 }
 
-// Returns random uint64 ID.
-func nextID() uint64 {
-	return rand.Uint64()
+// TraceID is a 128-bit trace identifier, as required by W3C Trace Context. Callers working with
+// 64-bit trace IDs leave `High` zero.
+type TraceID struct {
+	High uint64
+	Low  uint64
 }
 
-func StartRootSpan(ctx context.Context, event string, traceID uint64, parentSpanID uint64, attachment interface{}) (context.Context, TraceHandle) {
-	traceCtx := newTraceContext(traceID, attachment)
+func (id TraceID) IsZero() bool {
+	return id.High == 0 && id.Low == 0
+}
+
+// String returns the 32-digit lowercase hex representation.
+func (id TraceID) String() string {
+	var buf [16]byte
+	for i := 0; i < 8; i++ {
+		buf[i] = byte(id.High >> (56 - 8*i))
+		buf[i+8] = byte(id.Low >> (56 - 8*i))
+	}
+	return hex.EncodeToString(buf[:])
+}
+
+// StartRootSpan starts a trace. A zero `traceID` with a zero `parentSpanID` joins the remote parent
+// carried by ctx, if any, see `ContextWithRemoteSpanContext`; otherwise a zero `traceID` is replaced
+// by a new one, see `SetIDGenerator`.
+func StartRootSpan(ctx context.Context, event string, traceID TraceID, parentSpanID uint64, attachment interface{}, opts ...RootOption) (context.Context, TraceHandle) {
+	var options rootOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	remote, hasRemote := RemoteSpanContextFromContext(ctx)
+	if hasRemote && traceID.IsZero() && parentSpanID == 0 {
+		traceID = remote.TraceID
+		parentSpanID = remote.SpanID
+	}
+	if traceID.IsZero() {
+		traceID = idGenerator().NewTraceID()
+	}
+
+	params := SamplingParameters{
+		Context:      ctx,
+		Event:        event,
+		TraceID:      traceID,
+		ParentSpanID: parentSpanID,
+	}
+	if s, ok := ctx.Value(activeTraceKey).(*spanContext); ok {
+		params.HasParent = true
+		params.ParentSampled = s.traceContext.sampled
+	} else if hasRemote && traceID == remote.TraceID && parentSpanID == remote.SpanID {
+		params.HasParent = true
+		params.ParentSampled = remote.Sampled
+	}
+
+	sampled := shouldSample(params)
+	traceCtx := newTraceContext(traceID, attachment, sampled, options.clock)
+	if !sampled {
+		// Keep the IDs available through `CurrentID`, but skip recording. Descendants will see the
+		// unsampled trace and return finished handles directly.
+		spanCtx := newSpanContext(ctx, traceCtx)
+		spanCtx.spanID = nextID()
+		return spanCtx, TraceHandle{SpanHandle{spanContext: spanCtx, finished: true}}
+	}
+
+	var hooks *spanHooks
+	if options.profileLabels {
+		traceCtx.profileLabels = true
+		traceCtx.traceIDString = traceID.String()
+		hooks = &spanHooks{labelsToRestore: ctx}
+		ctx = withProfileLabels(ctx, traceCtx, event)
+	}
+	if options.runtimeTrace {
+		traceCtx.runtimeTrace = true
+		if rtrace.IsEnabled() {
+			if hooks == nil {
+				hooks = &spanHooks{}
+			}
+			ctx, hooks.task = rtrace.NewTask(ctx, event)
+			hooks.region = rtrace.StartRegion(ctx, event)
+		}
+	}
 	spanCtx := newSpanContext(ctx, traceCtx)
 	spanHandle := newSpanHandle(spanCtx, parentSpanID, event)
+	spanHandle.hooks = hooks
 	return spanCtx, TraceHandle{spanHandle}
 }
 
 func StartSpanWithContext(ctx context.Context, event string) (context.Context, SpanHandle) {
 	handle := StartSpan(ctx, event)
 	if !handle.finished {
+		if handle.spanContext.traceContext.profileLabels {
+			handle.spanContext.parent = withProfileLabels(handle.spanContext.parent, handle.spanContext.traceContext, event)
+			if handle.hooks == nil {
+				handle.hooks = &spanHooks{}
+			}
+			handle.hooks.labelsToRestore = ctx
+		}
 		return handle.spanContext, handle
 	}
 	return ctx, handle
@@ -60,11 +143,22 @@ func StartSpan(ctx context.Context, event string) (handle SpanHandle) {
 	}
 
 	traceCtx := parentSpanCtx.traceContext
+	if !traceCtx.sampled {
+		// Nothing is recorded, but the parent is kept so that `TraceID` still tells the trace.
+		handle.spanContext = parentSpanCtx
+		handle.finished = true
+		return
+	}
+
 	spanCtx := newSpanContext(parentCtx, traceCtx)
-	return newSpanHandle(spanCtx, parentSpanCtx.spanID, event)
+	handle = newSpanHandle(spanCtx, parentSpanCtx.spanID, event)
+	if traceCtx.runtimeTrace && rtrace.IsEnabled() {
+		handle.hooks = &spanHooks{region: rtrace.StartRegion(ctx, event)}
+	}
+	return handle
 }
 
-func CurrentID(ctx context.Context) (spanID uint64, traceID uint64, ok bool) {
+func CurrentID(ctx context.Context) (spanID uint64, traceID TraceID, ok bool) {
 	if s, ok := ctx.Value(activeTraceKey).(*spanContext); ok {
 		return s.spanID, s.traceContext.traceID, ok
 	}
@@ -72,6 +166,31 @@ func CurrentID(ctx context.Context) (spanID uint64, traceID uint64, ok bool) {
 	return
 }
 
+// IsSampled reports whether ctx carries an active trace that is being recorded.
+func IsSampled(ctx context.Context) bool {
+	if s, ok := ctx.Value(activeTraceKey).(*spanContext); ok {
+		return s.traceContext.sampled
+	}
+	return false
+}
+
+// AddEvent adds an event to the span active in ctx, for code which has the context but not the
+// `SpanHandle`, such as loggers. It returns false, dropping the event, if ctx has no recorded span
+// or the span has finished.
+func AddEvent(ctx context.Context, name string, properties ...Property) (ok bool) {
+	spanCtx, ok := ctx.Value(activeTraceKey).(*spanContext)
+	if !ok || !spanCtx.traceContext.sampled {
+		return false
+	}
+
+	traceCtx := spanCtx.traceContext
+	return traceCtx.pushEvent(spanCtx, Event{
+		Name:       name,
+		UnixTimeNs: traceCtx.unixTimeNs(traceCtx.monotimeNs()),
+		Properties: append([]Property(nil), properties...),
+	})
+}
+
 func AccessAttachment(ctx context.Context, fn func(attachment interface{})) (ok bool) {
 	spanCtx, ok := ctx.Value(activeTraceKey).(*spanContext)
 	if !ok {
@@ -84,11 +203,12 @@ type SpanHandle struct {
 	spanContext *spanContext
 	span        Span
 	finished    bool
+	hooks       *spanHooks // Set for some options of the trace only
 }
 
 func newSpanHandle(spanCtx *spanContext, parentSpanID uint64, event string) (sh SpanHandle) {
 	sh.spanContext = spanCtx
-	sh.span.beginWith(parentSpanID, event)
+	sh.span.beginWith(spanCtx.traceContext, parentSpanID, event)
 	sh.finished = false
 	spanCtx.spanID = sh.span.ID
 	return
@@ -98,7 +218,79 @@ func (sh *SpanHandle) AddProperty(key, value string) {
 	if sh.finished {
 		return
 	}
-	sh.span.addProperty(key, value)
+	sh.span.addProperty(StringProperty(key, value))
+}
+
+func (sh *SpanHandle) AddPropertyInt(key string, value int64) {
+	if sh.finished {
+		return
+	}
+	sh.span.addProperty(IntProperty(key, value))
+}
+
+func (sh *SpanHandle) AddPropertyBool(key string, value bool) {
+	if sh.finished {
+		return
+	}
+	sh.span.addProperty(BoolProperty(key, value))
+}
+
+func (sh *SpanHandle) AddPropertyFloat(key string, value float64) {
+	if sh.finished {
+		return
+	}
+	sh.span.addProperty(FloatProperty(key, value))
+}
+
+func (sh *SpanHandle) AddPropertyDuration(key string, value time.Duration) {
+	if sh.finished {
+		return
+	}
+	sh.span.addProperty(DurationProperty(key, value))
+}
+
+// SetEvent renames the span.
+func (sh *SpanHandle) SetEvent(event string) {
+	if sh.finished {
+		return
+	}
+	sh.span.Event = event
+}
+
+// SetRefType sets how the span relates to its parent. Spans are `ChildOf` their parents by default;
+// mark spans of spawned asynchronous work as `FollowsFrom`.
+func (sh *SpanHandle) SetRefType(refType RefType) {
+	if sh.finished {
+		return
+	}
+	sh.span.RefType = refType
+}
+
+// SetStatus marks the span as succeeded or failed with a description.
+func (sh *SpanHandle) SetStatus(code StatusCode, message string) {
+	if sh.finished {
+		return
+	}
+	sh.span.setStatus(code, message)
+}
+
+// SetError marks the span as failed with err. A nil err is ignored.
+func (sh *SpanHandle) SetError(err error) {
+	if sh.finished || err == nil {
+		return
+	}
+	sh.span.setError(err)
+}
+
+// AddEvent records that something happened at the current time within the span.
+func (sh *SpanHandle) AddEvent(name string, properties ...Property) {
+	if sh.finished {
+		return
+	}
+	if len(properties) > 0 {
+		properties = append([]Property(nil), properties...)
+	}
+	sh.span.addEvent(sh.spanContext.traceContext, name, properties)
 }
 
 func (sh *SpanHandle) AccessAttachment(fn func(attachment interface{})) {
@@ -116,10 +308,33 @@ func (sh *SpanHandle) Finish() {
 
 	traceCtx := sh.spanContext.traceContext
 	sh.span.endWith(traceCtx)
-	traceCtx.pushSpan(&sh.span)
+	traceCtx.pushSpan(sh.spanContext, &sh.span)
+
+	if sh.hooks != nil {
+		sh.hooks.finish()
+	}
 }
 
-func (sh *SpanHandle) TraceID() uint64 {
+// Discard ends the span without recording it, e.g. for a call which is retried by other means. Like
+// `Finish`, it must be called on the goroutine which started the span with some options.
+func (sh *SpanHandle) Discard() {
+	if sh.finished {
+		return
+	}
+	sh.finished = true
+	sh.spanContext.traceContext.discardSpan(sh.spanContext)
+
+	if sh.hooks != nil {
+		sh.hooks.finish()
+	}
+}
+
+// TraceID returns the ID of the trace the span belongs to, or a zero ID if it was started outside of any
+// trace.
+func (sh *SpanHandle) TraceID() TraceID {
+	if sh.spanContext == nil {
+		return TraceID{}
+	}
 	return sh.spanContext.traceContext.traceID
 }
 
@@ -127,6 +342,11 @@ type TraceHandle struct {
 	SpanHandle
 }
 
+// Sampled reports whether the trace is recorded. Collecting an unsampled trace yields no spans.
+func (th *TraceHandle) Sampled() bool {
+	return th.spanContext.traceContext.sampled
+}
+
 func (th *TraceHandle) Collect() (trace Trace, attachment interface{}) {
 	th.SpanHandle.Finish()
 	return th.spanContext.traceContext.collect()
@@ -14,11 +14,16 @@
 package minitrace
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"runtime/pprof"
+	rtrace "runtime/trace"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/opentracing/opentracing-go"
 	"sourcegraph.com/sourcegraph/appdash"
@@ -29,7 +34,7 @@ func BenchmarkMiniTrace(b *testing.B) {
 	for i := 100; i < 10001; i *= 10 {
 		b.Run(fmt.Sprintf("   %d", i), func(b *testing.B) {
 			for j := 0; j < b.N; j++ {
-				ctx, handle := StartRootSpan(context.Background(), "root", 10086, 0, nil)
+				ctx, handle := StartRootSpan(context.Background(), "root", TraceID{Low: 10086}, 0, nil)
 
 				for k := 1; k < i; k++ {
 					_, handle := StartSpanWithContext(ctx, strconv.Itoa(k))
@@ -81,7 +86,7 @@ func BenchmarkAppdashTrace(b *testing.B) {
 }
 
 func TestMiniTrace(t *testing.T) {
-	var traceID uint64 = 9527
+	traceID := TraceID{High: 1, Low: 9527}
 	ctx, handle := StartRootSpan(context.Background(), "root", traceID, 0, nil)
 	var wg sync.WaitGroup
 
@@ -91,7 +96,7 @@ func TestMiniTrace(t *testing.T) {
 			t.Fatalf("unmatched span ID: expected %d got %d", spanID, spanID1)
 		}
 		if traceID != traceID1 {
-			t.Fatalf("unmatched trace ID: expected %d got %d", traceID, traceID1)
+			t.Fatalf("unmatched trace ID: expected %s got %s", traceID, traceID1)
 		}
 	} else {
 		t.Fatalf("cannot get current span ID")
@@ -106,7 +111,7 @@ func TestMiniTrace(t *testing.T) {
 				t.Fatalf("unmatched span ID: expected %d got %d", spanID, spanID1)
 			}
 			if traceID != traceID1 {
-				t.Fatalf("unmatched trace ID: expected %d got %d", traceID, traceID1)
+				t.Fatalf("unmatched trace ID: expected %s got %s", traceID, traceID1)
 			}
 		} else {
 			t.Fatalf("cannot get current span ID")
@@ -135,3 +140,378 @@ func TestMiniTrace(t *testing.T) {
 		t.Fatalf("length of spanSets expected %d, but got %d", 29, len(trace.Spans))
 	}
 }
+
+func TestSampler(t *testing.T) {
+	defer SetSampler(nil)
+
+	SetSampler(NeverSample())
+	ctx, handle := StartRootSpan(context.Background(), "root", TraceID{Low: 9527}, 0, nil)
+	if handle.Sampled() {
+		t.Fatalf("expected an unsampled trace")
+	}
+	if _, traceID, ok := CurrentID(ctx); !ok || traceID.Low != 9527 {
+		t.Fatalf("expected trace ID %d to be kept, got %s", 9527, traceID)
+	}
+	if ctx1, handle := StartSpanWithContext(ctx, "child"); ctx1 != ctx || !handle.finished {
+		t.Fatalf("expected children of an unsampled trace to be finished")
+	} else if traceID := handle.TraceID(); traceID.Low != 9527 {
+		t.Fatalf("expected children of an unsampled trace to keep trace ID %d, got %s", 9527, traceID)
+	}
+	if handle := StartSpan(context.Background(), "orphan"); handle.TraceID() != (TraceID{}) {
+		t.Fatalf("expected a zero trace ID outside of any trace")
+	}
+	if trace, _ := handle.Collect(); len(trace.Spans) != 0 {
+		t.Fatalf("expected no spans, got %d", len(trace.Spans))
+	}
+
+	SetSampler(ParentBasedSampler(AlwaysSample()))
+	_, handle1 := StartRootSpan(ctx, "nested", TraceID{Low: 9528}, 0, nil)
+	if handle1.Sampled() {
+		t.Fatalf("expected to follow the unsampled parent")
+	}
+
+	SetSampler(RatioSampler(0.5))
+	sampled := 0
+	for i := uint64(0); i < 10000; i++ {
+		if _, handle := StartRootSpan(context.Background(), "root", TraceID{Low: i}, 0, nil); handle.Sampled() {
+			sampled++
+		}
+	}
+	if sampled < 4500 || sampled > 5500 {
+		t.Fatalf("expected about half of traces sampled, got %d", sampled)
+	}
+
+	// The rate is checked against a stopped clock, so a slow run does not refill the budget.
+	rateLimiting := RateLimitingSampler(10).(*rateLimitingSampler)
+	var nowNs uint64
+	rateLimiting.now = func() uint64 { return nowNs }
+	rateLimiting.lastMonoTimeNs = nowNs
+	SetSampler(rateLimiting)
+	sampleRoots := func() (sampled int) {
+		for i := uint64(0); i < 100; i++ {
+			if _, handle := StartRootSpan(context.Background(), "root", TraceID{Low: i}, 0, nil); handle.Sampled() {
+				sampled++
+			}
+		}
+		return
+	}
+	if sampled := sampleRoots(); sampled != 10 {
+		t.Fatalf("expected %d traces sampled, got %d", 10, sampled)
+	}
+	nowNs += uint64(500 * time.Millisecond)
+	if sampled := sampleRoots(); sampled != 5 {
+		t.Fatalf("expected %d traces sampled after half a second, got %d", 5, sampled)
+	}
+	// A clock read behind the last one must not refill the budget.
+	nowNs--
+	if sampled := sampleRoots(); sampled != 0 {
+		t.Fatalf("expected no traces sampled with a clock going back, got %d", sampled)
+	}
+}
+
+func TestSpanStatus(t *testing.T) {
+	ctx, handle := StartRootSpan(context.Background(), "root", TraceID{Low: 9527}, 0, nil)
+	handle.SetError(context.DeadlineExceeded)
+	handle.SetStatus(StatusOK, "")
+
+	child := StartSpan(ctx, "child")
+	child.SetError(nil)
+	child.SetError(context.Canceled)
+	child.Finish()
+
+	trace, _ := handle.Collect()
+	for _, span := range trace.Spans {
+		switch span.Event {
+		case "root":
+			if span.StatusCode != StatusOK || span.ErrorType != "" {
+				t.Fatalf("expected status %s without an error type, got %s %q", StatusOK, span.StatusCode, span.ErrorType)
+			}
+		case "child":
+			if span.StatusCode != StatusError || span.StatusMessage != "context canceled" || span.ErrorType != "*errors.errorString" {
+				t.Fatalf("unexpected status %s %q %q", span.StatusCode, span.StatusMessage, span.ErrorType)
+			}
+		}
+	}
+}
+
+func TestSpanEvent(t *testing.T) {
+	ctx, handle := StartRootSpan(context.Background(), "root", TraceID{Low: 9527}, 0, nil)
+	child := StartSpan(ctx, "child")
+	child.AddEvent("retry", Property{Key: "attempt", Value: "1"})
+	child.AddEvent("retry", Property{Key: "attempt", Value: "2"})
+	child.Finish()
+
+	trace, _ := handle.Collect()
+	for _, span := range trace.Spans {
+		if span.Event != "child" {
+			continue
+		}
+		if len(span.Events) != 2 {
+			t.Fatalf("expected 2 events, got %d", len(span.Events))
+		}
+		last := span.BeginUnixTimeNs
+		for _, event := range span.Events {
+			if event.UnixTimeNs < last || event.UnixTimeNs > span.BeginUnixTimeNs+span.DurationNs {
+				t.Fatalf("event time %d out of order or out of span", event.UnixTimeNs)
+			}
+			last = event.UnixTimeNs
+		}
+		if span.Events[1].Properties[0].Value != "2" {
+			t.Fatalf("unexpected event properties %v", span.Events[1].Properties)
+		}
+	}
+}
+
+func TestAddEventToContext(t *testing.T) {
+	if AddEvent(context.Background(), "orphan") {
+		t.Fatalf("expected no event without a span")
+	}
+
+	ctx, handle := StartRootSpan(context.Background(), "root", TraceID{Low: 9527}, 0, nil)
+	ctx, child := StartSpanWithContext(ctx, "child")
+	child.AddEvent("first")
+	if !AddEvent(ctx, "second", Property{Key: "k", Value: "v"}) {
+		t.Fatalf("expected the event to be added")
+	}
+	child.AddEvent("third")
+	child.Finish()
+	if AddEvent(ctx, "late") {
+		t.Fatalf("expected the event to be dropped after the span finishes")
+	}
+	if pending := handle.spanContext.traceContext.pendingEvents; len(pending) != 0 {
+		t.Fatalf("expected no pending events for a finished span, got %v", pending)
+	}
+
+	ctx, discarded := StartSpanWithContext(ctx, "discarded")
+	if !AddEvent(ctx, "dropped") {
+		t.Fatalf("expected the event to be added")
+	}
+	discarded.Discard()
+	if AddEvent(ctx, "late") {
+		t.Fatalf("expected the event to be dropped after the span is discarded")
+	}
+	if pending := handle.spanContext.traceContext.pendingEvents; len(pending) != 0 {
+		t.Fatalf("expected no pending events for a discarded span, got %v", pending)
+	}
+
+	trace, _ := handle.Collect()
+	events := trace.Spans[0].Events
+	if len(events) != 3 || events[0].Name != "first" || events[1].Name != "second" || events[2].Name != "third" {
+		t.Fatalf("unexpected events %v", events)
+	}
+	if events[1].Properties[0].Value != "v" {
+		t.Fatalf("unexpected event properties %v", events[1].Properties)
+	}
+}
+
+func TestTypedProperty(t *testing.T) {
+	_, handle := StartRootSpan(context.Background(), "root", TraceID{Low: 9527}, 0, nil)
+	handle.AddProperty("string", "value")
+	handle.AddPropertyInt("int", -42)
+	handle.AddPropertyBool("bool", true)
+	handle.AddPropertyFloat("float", 0.25)
+	handle.AddPropertyDuration("duration", 1500*time.Microsecond)
+	trace, _ := handle.Collect()
+
+	expected := []string{"value", "-42", "true", "0.25", "1.5ms"}
+	properties := trace.Spans[0].Properties
+	for i, property := range properties {
+		if property.ValueString() != expected[i] {
+			t.Fatalf("expected %s, got %s", expected[i], property.ValueString())
+		}
+	}
+	if properties[1].Int() != -42 || !properties[2].Bool() || properties[3].Float() != 0.25 || properties[4].Duration() != 1500*time.Microsecond {
+		t.Fatalf("unexpected typed values %v", properties)
+	}
+}
+
+func BenchmarkAddPropertyInt(b *testing.B) {
+	_, handle := StartRootSpan(context.Background(), "root", TraceID{Low: 9527}, 0, nil)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		handle.span.Properties = handle.span.Properties[:0]
+		handle.AddPropertyInt("int", int64(i))
+	}
+}
+
+func TestTraceTree(t *testing.T) {
+	ctx, root := StartRootSpan(context.Background(), "root", TraceID{Low: 9527}, 0, nil)
+	ctx1, unfinished := StartSpanWithContext(ctx, "unfinished")
+	orphan := StartSpan(ctx1, "orphan")
+	orphan.Finish()
+	second := StartSpan(ctx, "second")
+	second.Finish()
+	_ = unfinished
+	trace, _ := root.Collect()
+
+	tree := trace.Tree()
+	if len(tree.Roots) != 1 || tree.Roots[0].Span.Event != "root" {
+		t.Fatalf("unexpected roots %v", tree.Roots)
+	}
+	if children := tree.Roots[0].Children; len(children) != 1 || children[0].Span.Event != "second" {
+		t.Fatalf("unexpected children %v", children)
+	}
+	if len(tree.Orphans) != 1 || tree.Orphans[0].Span.Event != "orphan" {
+		t.Fatalf("unexpected orphans %v", tree.Orphans)
+	}
+
+	// The root of a trace joining a remote trace has a parent outside of the trace.
+	trace = Trace{Spans: []Span{
+		{ID: 3, ParentID: 2, Event: "orphan", BeginUnixTimeNs: 9_100_000, DurationNs: 1_100_000},
+		{ID: 4, ParentID: 1, Event: "failed", BeginUnixTimeNs: 3_400_000, DurationNs: 8_900_000, StatusCode: StatusError, StatusMessage: "region unavailable"},
+		{ID: 5, ParentID: 1, Event: "child", BeginUnixTimeNs: 100_000, DurationNs: 3_200_000, Properties: []Property{IntProperty("rows", 3)}},
+		{ID: 1, ParentID: 100, Event: "root", BeginUnixTimeNs: 0, DurationNs: 12_500_000},
+	}}
+	expected := "" +
+		"       0s    12.5ms  root\n" +
+		"    100µs     3.2ms    child rows=3\n" +
+		"    3.4ms     8.9ms    failed error=\"region unavailable\"\n" +
+		"    9.1ms     1.1ms  orphan (orphan)\n"
+	if actual := trace.Tree().String(); actual != expected {
+		t.Fatalf("unexpected rendering:\n%s", actual)
+	}
+}
+
+// Returns the profile labels of the goroutine running `TestProfileLabels`, as shown in the
+// goroutine profile.
+func testGoroutineLabels(t *testing.T) string {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range strings.Split(buf.String(), "\n\n") {
+		if !strings.Contains(record, "minitrace-go.TestProfileLabels") {
+			continue
+		}
+		for _, line := range strings.Split(record, "\n") {
+			if strings.HasPrefix(line, "# labels: ") {
+				return strings.TrimPrefix(line, "# labels: ")
+			}
+		}
+		return ""
+	}
+	t.Fatalf("goroutine not found in profile")
+	return ""
+}
+
+func TestProfileLabels(t *testing.T) {
+	ctx, root := StartRootSpan(context.Background(), "root", TraceID{Low: 9527}, 0, nil, WithProfileLabels())
+	rootLabels := `{"span_event":"root", "trace_id":"00000000000000000000000000002537"}`
+	if labels := testGoroutineLabels(t); labels != rootLabels {
+		t.Fatalf("unexpected labels %s", labels)
+	}
+
+	childCtx, child := StartSpanWithContext(ctx, "child")
+	if labels := testGoroutineLabels(t); labels != `{"span_event":"child", "trace_id":"00000000000000000000000000002537"}` {
+		t.Fatalf("unexpected labels %s", labels)
+	}
+	if event, _ := pprof.Label(childCtx, ProfileLabelSpanEvent); event != "child" {
+		t.Fatalf("expected the labels in the context, got %q", event)
+	}
+
+	child.Finish()
+	if labels := testGoroutineLabels(t); labels != rootLabels {
+		t.Fatalf("expected the labels of the parent to be restored, got %s", labels)
+	}
+	_, discarded := StartSpanWithContext(ctx, "discarded")
+	discarded.Discard()
+	if labels := testGoroutineLabels(t); labels != rootLabels {
+		t.Fatalf("expected a discarded span to restore the labels of the parent, got %s", labels)
+	}
+	if trace, _ := root.Collect(); len(trace.Spans) != 2 {
+		t.Fatalf("expected the discarded span not to be recorded, got %v", trace.Spans)
+	}
+	if labels := testGoroutineLabels(t); labels != "" {
+		t.Fatalf("expected no labels after the trace, got %s", labels)
+	}
+
+	// Spans of traces without the option leave the labels alone.
+	ctx, root = StartRootSpan(context.Background(), "root", TraceID{Low: 9527}, 0, nil)
+	_, child = StartSpanWithContext(ctx, "child")
+	if labels := testGoroutineLabels(t); labels != "" {
+		t.Fatalf("unexpected labels %s", labels)
+	}
+	child.Finish()
+	root.Collect()
+}
+
+func TestRuntimeTrace(t *testing.T) {
+	if rtrace.IsEnabled() {
+		t.Skip("an execution trace is already being captured")
+	}
+
+	// Without an execution trace, spans have nothing to do on finish.
+	ctx, root := StartRootSpan(context.Background(), "root", TraceID{Low: 9527}, 0, nil, WithRuntimeTrace())
+	if child := StartSpan(ctx, "child"); child.hooks != nil || root.hooks != nil {
+		t.Fatalf("expected no regions without an execution trace")
+	}
+	root.Collect()
+
+	var buf bytes.Buffer
+	if err := rtrace.Start(&buf); err != nil {
+		t.Fatal(err)
+	}
+	ctx, root = StartRootSpan(context.Background(), "traced-root", TraceID{Low: 9527}, 0, nil, WithRuntimeTrace())
+	child := StartSpan(ctx, "traced-child")
+	child.Finish()
+	root.Collect()
+	rtrace.Stop()
+
+	// Task and region names are written to the string table of the execution trace.
+	for _, name := range []string{"traced-root", "traced-child"} {
+		if !bytes.Contains(buf.Bytes(), []byte(name)) {
+			t.Fatalf("expected %q in the execution trace", name)
+		}
+	}
+}
+
+func TestIDGenerator(t *testing.T) {
+	_, root := StartRootSpan(context.Background(), "root", TraceID{}, 0, nil)
+	if trace, _ := root.Collect(); trace.TraceID.IsZero() {
+		t.Fatalf("expected a trace ID to be generated")
+	}
+
+	SetIDGenerator(NewSequentialIDGenerator())
+	defer SetIDGenerator(nil)
+
+	for i := uint64(1); i <= 2; i++ {
+		ctx, root := StartRootSpan(context.Background(), "root", TraceID{}, 0, nil)
+		child := StartSpan(ctx, "child")
+		child.Finish()
+		trace, _ := root.Collect()
+		if trace.TraceID != (TraceID{Low: i}) {
+			t.Fatalf("expected trace ID %d, got %s", i, trace.TraceID)
+		}
+		if trace.Spans[0].ID != 2*i || trace.Spans[1].ID != 2*i-1 || trace.Spans[0].ParentID != 2*i-1 {
+			t.Fatalf("unexpected span IDs %v", trace.Spans)
+		}
+	}
+
+	// A given trace ID is kept.
+	_, root = StartRootSpan(context.Background(), "root", TraceID{Low: 9527}, 0, nil)
+	if trace, _ := root.Collect(); trace.TraceID != (TraceID{Low: 9527}) {
+		t.Fatalf("unexpected trace ID %s", trace.TraceID)
+	}
+
+	for _, g := range []IDGenerator{FastIDGenerator(), CryptoIDGenerator()} {
+		seen := map[uint64]bool{}
+		for i := 0; i < 1000; i++ {
+			id := g.NewSpanID()
+			if id == 0 || seen[id] {
+				t.Fatalf("unexpected span ID %d from %T", id, g)
+			}
+			seen[id] = true
+		}
+		if a, b := g.NewTraceID(), g.NewTraceID(); a.IsZero() || a == b || a.High == 0 {
+			t.Fatalf("unexpected trace IDs %s %s from %T", a, b, g)
+		}
+	}
+}
+
+func BenchmarkNextID(b *testing.B) {
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			nextID()
+		}
+	})
+}
@@ -0,0 +1,169 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package minitrace
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SpanNode is a span with its children, sorted by begin time.
+type SpanNode struct {
+	Span     Span
+	Children []*SpanNode
+}
+
+// TraceTree is the hierarchy of the spans of a trace.
+type TraceTree struct {
+	// Usually the single root span. A root joining a remote trace has a parent outside of the trace.
+	Roots []*SpanNode
+	// Spans whose parent is missing from the trace, because it never finished before the trace was
+	// collected.
+	Orphans []*SpanNode
+}
+
+// Tree rebuilds the hierarchy of the spans from `Span.ParentID`.
+//
+// Spans without a parent in the trace are roots if `ParentID` is 0. If there is no such span, the
+// first of them to begin is the root, being the child of a remote parent. The others are orphans.
+func (t Trace) Tree() TraceTree {
+	nodes := make(map[uint64]*SpanNode, len(t.Spans))
+	for i := range t.Spans {
+		nodes[t.Spans[i].ID] = &SpanNode{Span: t.Spans[i]}
+	}
+
+	var tree TraceTree
+	var parentless []*SpanNode
+	for i := range t.Spans {
+		node := nodes[t.Spans[i].ID]
+		parentID := node.Span.ParentID
+		if parent, ok := nodes[parentID]; ok && parentID != node.Span.ID {
+			parent.Children = append(parent.Children, node)
+		} else if parentID == 0 {
+			tree.Roots = append(tree.Roots, node)
+		} else {
+			parentless = append(parentless, node)
+		}
+	}
+
+	for _, node := range nodes {
+		sortSpanNodes(node.Children)
+	}
+	sortSpanNodes(tree.Roots)
+	sortSpanNodes(parentless)
+	if len(tree.Roots) == 0 && len(parentless) > 0 {
+		tree.Roots, parentless = parentless[:1], parentless[1:]
+	}
+	if len(parentless) > 0 {
+		tree.Orphans = parentless
+	}
+	return tree
+}
+
+func sortSpanNodes(nodes []*SpanNode) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].Span.BeginUnixTimeNs < nodes[j].Span.BeginUnixTimeNs
+	})
+}
+
+// Walk calls fn for the roots, the orphans and their descendants in depth-first order, until fn
+// returns false.
+func (tree TraceTree) Walk(fn func(node *SpanNode, depth int) bool) {
+	var walk func(nodes []*SpanNode, depth int) bool
+	walk = func(nodes []*SpanNode, depth int) bool {
+		for _, node := range nodes {
+			if !fn(node, depth) || !walk(node.Children, depth+1) {
+				return false
+			}
+		}
+		return true
+	}
+	if walk(tree.Roots, 0) {
+		walk(tree.Orphans, 0)
+	}
+}
+
+// WriteText renders the tree as an indented timeline, one span per line with its offset from the
+// beginning of the trace, its duration, its event and its properties:
+//
+//	   0s    12.5ms  root
+//	100µs     3.2ms    child rows=3
+//	3.4ms     8.9ms    failed error="region unavailable"
+//	9.1ms     1.1ms  orphan (orphan)
+func (tree TraceTree) WriteText(w io.Writer) error {
+	var start uint64
+	first := true
+	tree.Walk(func(node *SpanNode, depth int) bool {
+		if first || node.Span.BeginUnixTimeNs < start {
+			start = node.Span.BeginUnixTimeNs
+			first = false
+		}
+		return true
+	})
+
+	orphans := make(map[*SpanNode]struct{}, len(tree.Orphans))
+	for _, node := range tree.Orphans {
+		orphans[node] = struct{}{}
+	}
+
+	var b strings.Builder
+	tree.Walk(func(node *SpanNode, depth int) bool {
+		span := &node.Span
+		fmt.Fprintf(&b, "%9s %9s  %s%s",
+			formatDuration(span.BeginUnixTimeNs-start),
+			formatDuration(span.DurationNs),
+			strings.Repeat("  ", depth),
+			span.Event,
+		)
+		for _, property := range span.Properties {
+			fmt.Fprintf(&b, " %s=%s", property.Key, quoteIfNeeded(property.ValueString()))
+		}
+		if span.StatusCode == StatusError {
+			fmt.Fprintf(&b, " error=%s", quoteIfNeeded(span.StatusMessage))
+		}
+		if _, ok := orphans[node]; ok {
+			b.WriteString(" (orphan)")
+		}
+		b.WriteByte('\n')
+		return true
+	})
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (tree TraceTree) String() string {
+	var b strings.Builder
+	_ = tree.WriteText(&b)
+	return b.String()
+}
+
+// Rounds to microseconds, which is precise enough for reading.
+func formatDuration(ns uint64) string {
+	d := time.Duration(ns)
+	if d >= time.Microsecond {
+		d = d.Round(time.Microsecond)
+	}
+	return d.String()
+}
+
+func quoteIfNeeded(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return fmt.Sprintf("%q", s)
+	}
+	return s
+}
@@ -0,0 +1,136 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tsc provides a clock reading the CPU timestamp counter, which is cheaper than the clock of
+// the runtime. Use it for traces of very fine-grained operations:
+//
+//	ctx, root := minitrace.StartRootSpan(ctx, "root", traceID, 0, nil, minitrace.WithClock(tsc.Clock()))
+//
+// The counter is only used on linux/amd64 with an invariant TSC, i.e. one ticking at a constant
+// rate across frequency changes and sleep states. Elsewhere, the clock is the runtime clock.
+package tsc
+
+import (
+	"bytes"
+	"math/bits"
+	"sync"
+	"time"
+
+	"github.com/tikv/minitrace-go"
+)
+
+var (
+	once  sync.Once
+	clock minitrace.Clock
+)
+
+// Clock returns the TSC clock, or `minitrace.SystemClock` if the TSC cannot be used. The first
+// call calibrates the TSC, which takes about 10ms.
+func Clock() minitrace.Clock {
+	once.Do(func() {
+		clock = minitrace.SystemClock()
+		if c, ok := newTSCClock(); ok {
+			clock = c
+		}
+	})
+	return clock
+}
+
+// Available reports whether `Clock` reads the TSC.
+func Available() bool {
+	_, ok := Clock().(*tscClock)
+	return ok
+}
+
+// Converts ticks to nanoseconds from a reference point, in fixed point with `shift` fractional bits.
+type tscClock struct {
+	baseTicks uint64
+	baseNs    uint64
+	mult      uint64
+	system    minitrace.Clock
+}
+
+const shift = 32
+
+func (c *tscClock) MonotonicNs() uint64 {
+	ticks := rdtsc() - c.baseTicks
+	// The counters of the cores may be slightly apart, so a core could read before the base.
+	if int64(ticks) < 0 {
+		return c.baseNs
+	}
+	hi, lo := bits.Mul64(ticks, c.mult)
+	return c.baseNs + (hi<<(64-shift) | lo>>shift)
+}
+
+// UnixNs reads the runtime clock, as it is called only once per trace.
+func (c *tscClock) UnixNs() uint64 {
+	return c.system.UnixNs()
+}
+
+const calibrationTime = 10 * time.Millisecond
+
+// Measures the TSC frequency against the monotonic clock of the runtime.
+func calibrate(system minitrace.Clock) (*tscClock, bool) {
+	ticks0, ns0 := readPair(system)
+	time.Sleep(calibrationTime)
+	ticks1, ns1 := readPair(system)
+	if ticks1 <= ticks0 || ns1 <= ns0 {
+		return nil, false
+	}
+
+	// Nanoseconds per tick in fixed point. TSC frequencies are above 100MHz, so ticks are shorter
+	// than 10ns and the multiplier fits easily.
+	mult := (ns1 - ns0) << shift / (ticks1 - ticks0)
+	if mult == 0 || mult > 10<<shift {
+		return nil, false
+	}
+	return &tscClock{baseTicks: ticks1, baseNs: ns1, mult: mult, system: system}, true
+}
+
+// Reads the TSC and the monotonic clock at about the same time, retrying to exclude reads
+// interrupted by preemption.
+func readPair(system minitrace.Clock) (ticks uint64, ns uint64) {
+	best := ^uint64(0)
+	for i := 0; i < 10; i++ {
+		before := system.MonotonicNs()
+		t := rdtsc()
+		after := system.MonotonicNs()
+		if after-before < best {
+			best = after - before
+			ticks, ns = t, before+(after-before)/2
+		}
+	}
+	return
+}
+
+// Reports whether the flags of the first processor in /proc/cpuinfo include an invariant TSC.
+func hasInvariantTSC(cpuinfo []byte) bool {
+	for _, line := range bytes.Split(cpuinfo, []byte("\n")) {
+		i := bytes.IndexByte(line, ':')
+		if i < 0 || string(bytes.TrimSpace(line[:i])) != "flags" {
+			continue
+		}
+		value := line[i+1:]
+		var constant, nonstop bool
+		for _, flag := range bytes.Fields(value) {
+			switch string(flag) {
+			case "constant_tsc":
+				constant = true
+			case "nonstop_tsc":
+				nonstop = true
+			}
+		}
+		return constant && nonstop
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tsc
+
+import (
+	"io/ioutil"
+
+	"github.com/tikv/minitrace-go"
+)
+
+// Implemented in tsc_linux_amd64.s.
+func rdtsc() uint64
+
+func newTSCClock() (*tscClock, bool) {
+	cpuinfo, err := ioutil.ReadFile("/proc/cpuinfo")
+	if err != nil || !hasInvariantTSC(cpuinfo) {
+		return nil, false
+	}
+	return calibrate(minitrace.SystemClock())
+}
@@ -0,0 +1,77 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tsc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tikv/minitrace-go"
+)
+
+func TestHasInvariantTSC(t *testing.T) {
+	for cpuinfo, expected := range map[string]bool{
+		"processor\t: 0\nflags\t\t: fpu tsc constant_tsc nonstop_tsc rdtscp\n":                        true,
+		"processor\t: 0\nflags\t\t: fpu tsc constant_tsc rdtscp\n":                                    false,
+		"processor\t: 0\nflags\t\t: fpu tsc\n\nprocessor\t: 1\nflags\t\t: constant_tsc nonstop_tsc\n": false,
+		"processor\t: 0\nFeatures\t: fp asimd\n":                                                      false,
+	} {
+		if actual := hasInvariantTSC([]byte(cpuinfo)); actual != expected {
+			t.Fatalf("expected %v for %q", expected, cpuinfo)
+		}
+	}
+}
+
+func TestClock(t *testing.T) {
+	c := Clock()
+	if !Available() {
+		if c != minitrace.SystemClock() {
+			t.Fatalf("expected the runtime clock as a fallback")
+		}
+		t.Skip("TSC is not available")
+	}
+
+	system := minitrace.SystemClock()
+	tsc0, sys0 := c.MonotonicNs(), system.MonotonicNs()
+	time.Sleep(50 * time.Millisecond)
+	tsc1, sys1 := c.MonotonicNs(), system.MonotonicNs()
+	if tsc1 < tsc0 {
+		t.Fatalf("clock went backwards from %d to %d", tsc0, tsc1)
+	}
+	// Calibration is precise to a fraction of a percent, but allow for slow machines.
+	elapsed, expected := time.Duration(tsc1-tsc0), time.Duration(sys1-sys0)
+	if elapsed < expected*9/10 || elapsed > expected*11/10 {
+		t.Fatalf("TSC measured %s while the runtime clock measured %s", elapsed, expected)
+	}
+
+	ctx, root := minitrace.StartRootSpan(context.Background(), "root", minitrace.TraceID{}, 0, nil, minitrace.WithClock(c))
+	child := minitrace.StartSpan(ctx, "child")
+	time.Sleep(time.Millisecond)
+	child.Finish()
+	trace, _ := root.Collect()
+	if span := trace.Spans[0]; span.DurationNs < uint64(time.Millisecond) || span.DurationNs > uint64(time.Second) {
+		t.Fatalf("unexpected duration %d", span.DurationNs)
+	}
+}
+
+func BenchmarkClock(b *testing.B) {
+	for name, c := range map[string]minitrace.Clock{"tsc": Clock(), "system": minitrace.SystemClock()} {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				c.MonotonicNs()
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zipkin
+
+// Span is a span in the Zipkin v2 JSON model.
+type Span struct {
+	TraceID       string            `json:"traceId"`
+	ID            string            `json:"id"`
+	ParentID      string            `json:"parentId,omitempty"`
+	Name          string            `json:"name"`
+	TimestampUs   int64             `json:"timestamp"`
+	DurationUs    int64             `json:"duration"`
+	LocalEndpoint Endpoint          `json:"localEndpoint"`
+	Tags          map[string]string `json:"tags,omitempty"`
+	Annotations   []Annotation      `json:"annotations,omitempty"`
+}
+
+type Annotation struct {
+	TimestampUs int64  `json:"timestamp"`
+	Value       string `json:"value"`
+}
+
+type Endpoint struct {
+	ServiceName string `json:"serviceName"`
+}
@@ -0,0 +1,151 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zipkin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/tikv/minitrace-go"
+)
+
+func Send(buf io.Reader, collector string) error {
+	return send(context.Background(), buf, collector)
+}
+
+func send(ctx context.Context, buf io.Reader, collector string) error {
+	req, err := http.NewRequest("POST", fmt.Sprintf("http://%s/api/v2/spans", collector), buf)
+	if err != nil {
+		return fmt.Errorf("cannot create http request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	response, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if code := response.StatusCode; code >= 400 {
+		msg := make([]byte, 1000)
+		n, _ := response.Body.Read(msg)
+		txt := http.StatusText(code)
+		if n > 0 {
+			return fmt.Errorf("%s (Status: %s)", msg[:n], txt)
+		}
+		return fmt.Errorf("%s", txt)
+	}
+	return nil
+}
+
+func JSONEncode(buf io.Writer, spans []Span) error {
+	return json.NewEncoder(buf).Encode(spans)
+}
+
+// Exporter sends traces to a Zipkin collector, one HTTP request per batch.
+type Exporter struct {
+	ServiceName string
+	Collector   string
+}
+
+func NewExporter(serviceName string, collector string) *Exporter {
+	return &Exporter{ServiceName: serviceName, Collector: collector}
+}
+
+func (e *Exporter) Export(ctx context.Context, traces []minitrace.Trace) error {
+	var spans []Span
+	for _, trace := range traces {
+		spans = append(spans, MiniSpansToZipkinSpans(e.ServiceName, trace)...)
+	}
+	// Zipkin rejects a null body, which an empty batch would encode to.
+	if len(spans) == 0 {
+		return nil
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	if err := JSONEncode(buf, spans); err != nil {
+		return err
+	}
+	return send(ctx, buf, e.Collector)
+}
+
+func MiniSpansToZipkinSpans(
+	serviceName string,
+	trace minitrace.Trace,
+) []Span {
+	spans := trace.Spans
+	retSpans := make([]Span, 0, len(spans))
+
+	// Zipkin accepts both 64-bit and 128-bit trace IDs.
+	traceID := fmt.Sprintf("%016x", trace.TraceID.Low)
+	if trace.TraceID.High != 0 {
+		traceID = trace.TraceID.String()
+	}
+
+	for _, span := range spans {
+		var tags map[string]string
+		if len(span.Properties) > 0 || span.StatusCode == minitrace.StatusError {
+			tags = make(map[string]string, len(span.Properties)+1)
+			for _, property := range span.Properties {
+				tags[property.Key] = property.ValueString()
+			}
+			// Zipkin marks failed spans by an `error` tag holding the message.
+			if span.StatusCode == minitrace.StatusError {
+				tags["error"] = span.StatusMessage
+			}
+		}
+
+		var annotations []Annotation
+		for _, event := range span.Events {
+			// Annotations carry a single string, so properties are appended to the event name.
+			value := event.Name
+			for _, property := range event.Properties {
+				value += " " + property.Key + "=" + property.ValueString()
+			}
+			annotations = append(annotations, Annotation{
+				TimestampUs: int64(event.UnixTimeNs / 1000),
+				Value:       value,
+			})
+		}
+
+		var parentID string
+		if span.ParentID != 0 {
+			parentID = fmt.Sprintf("%016x", span.ParentID)
+		}
+
+		// Zipkin treats a zero duration as unknown, so sub-microsecond spans are rounded up.
+		durationUs := int64(span.DurationNs / 1000)
+		if durationUs == 0 {
+			durationUs = 1
+		}
+
+		retSpans = append(retSpans, Span{
+			TraceID:       traceID,
+			ID:            fmt.Sprintf("%016x", span.ID),
+			ParentID:      parentID,
+			Name:          span.Event,
+			TimestampUs:   int64(span.BeginUnixTimeNs / 1000),
+			DurationUs:    durationUs,
+			LocalEndpoint: Endpoint{ServiceName: serviceName},
+			Tags:          tags,
+			Annotations:   annotations,
+		})
+	}
+
+	return retSpans
+}
@@ -0,0 +1,88 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package zipkin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tikv/minitrace-go"
+)
+
+func TestZipkin(t *testing.T) {
+	var requests int
+	var received []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/api/v2/spans" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	ctx, handle := minitrace.StartRootSpan(context.Background(), "root", minitrace.TraceID{Low: 10010}, 0, nil)
+	handle.AddProperty("event1", "root")
+	child := minitrace.StartSpan(ctx, "child")
+	child.AddEvent("retry", minitrace.Property{Key: "attempt", Value: "2"})
+	child.Finish()
+	trace, _ := handle.Collect()
+
+	exporter := NewExporter("zipkin-test", strings.TrimPrefix(server.URL, "http://"))
+	// Batches without spans are not sent.
+	if err := exporter.Export(context.Background(), []minitrace.Trace{{TraceID: trace.TraceID}}); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 0 {
+		t.Fatalf("expected no request for an empty batch, got %d", requests)
+	}
+	if err := exporter.Export(context.Background(), []minitrace.Trace{trace}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(received) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(received))
+	}
+	spans := map[string]map[string]interface{}{}
+	for _, span := range received {
+		if span["traceId"] != "000000000000271a" {
+			t.Fatalf("unexpected trace ID %v", span["traceId"])
+		}
+		if span["localEndpoint"].(map[string]interface{})["serviceName"] != "zipkin-test" {
+			t.Fatalf("unexpected local endpoint %v", span["localEndpoint"])
+		}
+		spans[span["name"].(string)] = span
+	}
+	if _, ok := spans["root"]["parentId"]; ok {
+		t.Fatalf("expected no parent for the root span")
+	}
+	if spans["child"]["parentId"] != spans["root"]["id"] {
+		t.Fatalf("expected the child to reference the root span")
+	}
+	if annotations := spans["child"]["annotations"].([]interface{}); annotations[0].(map[string]interface{})["value"] != "retry attempt=2" {
+		t.Fatalf("unexpected annotations %v", annotations)
+	}
+	if spans["root"]["tags"].(map[string]interface{})["event1"] != "root" {
+		t.Fatalf("unexpected tags %v", spans["root"]["tags"])
+	}
+}